@@ -1,58 +1,79 @@
 package api
 
 import (
+	"fmt"
 	"log"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"github.com/mhghw/fara-message/db"
+	"github.com/mhghw/fara-message/throttle"
 )
 
 type UserData struct {
-	Username        string `json:"username"`
-	Password        string `json:"password"`
-	ConfirmPassword string `json:"confirm_password"`
+	CurrentPassword string `json:"current_password" validate:"required"`
+	Password        string `json:"password" validate:"password"`
+	ConfirmPassword string `json:"confirm_password" validate:"eqfield=Password"`
 }
 
-// suppose users post their usernames to edit information
-func changePassword(c *gin.Context) {
+// changePassword sets a new password for the calling user, who has to know
+// the current one.
+func (s *Server) changePassword(c *gin.Context) {
 	var user UserData
-
-	err := c.BindJSON(&user)
-	if err != nil {
-		log.Printf("error binding JSON:%v", err)
-		c.Status(400)
+	if !s.bindJSON(c, &user) {
 		return
 	}
 
-	if len(user.Username) < 3 {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "the username is incorrect",
-		})
+	// The principal's user is loaded without the password hash.
+	userUnderReview, err := s.store.ReadUserByUsername(currentPrincipal(c).User.Username)
+	if err != nil {
+		respondError(c, err)
 		return
 	}
-	if user.Password != user.ConfirmPassword {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "password does not match",
-		})
+	if !s.checkCurrentPassword(c, userUnderReview, user.CurrentPassword) {
 		return
 	}
 
-	userUnderReviewTable, err := db.Mysql.ReadUserByUsername(user.Username)
+	hashedPassword, err := s.passwords.Hash(user.Password)
 	if err != nil {
-		log.Printf("error getting user from database:%v", err)
-		c.Status(400)
+		respondError(c, fmt.Errorf("failed to hash password: %w", err))
 		return
 	}
-	userUnderReviewTable.Password = user.Password
 
-	err = db.Mysql.UpdateUser(userUnderReviewTable.ID, userUnderReviewTable)
+	err = s.store.UpdateUser(userUnderReview.ID, db.UserTable{Password: hashedPassword})
 	if err != nil {
-		log.Printf("error updating user:%v", err)
-		c.Status(400)
+		respondError(c, err)
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{
 		"message": "password change successfully",
 	})
 }
+
+// checkCurrentPassword verifies the password a user entered to confirm a
+// change and answers when it is wrong. Guesses are throttled per user like
+// logins, so that a stolen access token is no way to find the password out.
+func (s *Server) checkCurrentPassword(c *gin.Context, user db.UserTable, password string) bool {
+	key := throttle.PasswordKey(user.ID)
+	if !s.checkLoginThrottle(c, key) {
+		return false
+	}
+	match, _, err := s.passwords.Verify(password, user.Password)
+	if err != nil {
+		log.Printf("failed to verify password of user %s: %v", user.ID, err)
+	}
+	if !match {
+		verdict, err := s.loginLimiter.Fail(c.Request.Context(), key, c.ClientIP())
+		if err != nil {
+			log.Printf("failed to record failed password check: %v", err)
+		}
+		if verdict.Locked {
+			tooManyAttempts(c, verdict)
+			return false
+		}
+		respondError(c, errValidation("current password is incorrect"))
+		return false
+	}
+	s.clearLoginThrottle(c, key)
+	return true
+}
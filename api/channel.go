@@ -0,0 +1,95 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mhghw/fara-message/db"
+)
+
+// Channels are for announcements: only admins post, everybody else
+// subscribes and reads. A channel with a handle is public and can be found
+// through GET /channels; others are only reachable through invite links.
+
+const channelSearchLimit = 20
+
+type ChannelRequest struct {
+	Name   string `json:"name" validate:"required,max=255"`
+	Handle string `json:"handle" validate:"omitempty,handle"`
+}
+
+// NewChannelHandler creates a channel owned by the caller.
+func (s *Server) NewChannelHandler(c *gin.Context) {
+	var requestBody ChannelRequest
+	if !s.bindJSON(c, &requestBody) {
+		return
+	}
+	chatID, err := s.store.NewChannel(requestBody.Name, requestBody.Handle, currentPrincipal(c).UserID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	s.publishChatCreated(chatID, requestBody.Name, db.Channel)
+	c.JSON(http.StatusOK, chatID)
+}
+
+// SearchChannelsHandler finds public channels by handle or name, the ones
+// with the most subscribers first. Without ?q= it lists the biggest.
+func (s *Server) SearchChannelsHandler(c *gin.Context) {
+	channels, err := s.store.SearchChannels(c.Query("q"), channelSearchLimit)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	response := make([]ChannelResponse, 0, len(channels))
+	for _, channel := range channels {
+		response = append(response, convertChannelToResponse(channel))
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func (s *Server) GetChannelHandler(c *gin.Context) {
+	channel, err := s.store.GetChannelByHandle(c.Param("handle"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, convertChannelToResponse(channel))
+}
+
+// SubscribeChannelHandler adds the caller to a public channel.
+func (s *Server) SubscribeChannelHandler(c *gin.Context) {
+	userID := currentPrincipal(c).UserID
+	chat, err := s.store.GetChat(c.Param("id"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	// Private channels and other chats look the same as missing ones.
+	if !isChannel(chat) || !chat.Handle.Valid {
+		respondError(c, errNotFound("channel not found"))
+		return
+	}
+	if err := s.store.AddChatMember(chat.ID, userID); err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "subscribed successfully"})
+}
+
+// UnsubscribeChannelHandler takes the caller out of a channel.
+func (s *Server) UnsubscribeChannelHandler(c *gin.Context) {
+	userID := currentPrincipal(c).UserID
+	member, ok := s.authorizeChat(c, userID, c.Param("id"), PermissionLeaveChat)
+	if !ok {
+		return
+	}
+	if !isChannel(member.ChatTable) {
+		respondError(c, errInvalidRequest("only channels have subscribers"))
+		return
+	}
+	if !s.leaveChat(c, member) {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "unsubscribed successfully"})
+}
@@ -1,75 +1,64 @@
 package api
 
 import (
-	"errors"
 	"log"
+	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"github.com/mhghw/fara-message/db"
-	"github.com/rs/xid"
 )
 
 type GroupChatRequest struct {
-	ChatName string         `json:"chatName"`
-	Users    []db.UserTable `json:"users"`
+	ChatName string         `json:"chatName" validate:"max=255"`
+	Users    []db.UserTable `json:"users" validate:"min=1"`
 }
 type DirectChatRequest struct {
-	UserID string `json:"username"`
+	UserID string `json:"username" validate:"required"`
 }
 
-func NewDirectChatHandler(c *gin.Context) {
+func (s *Server) NewDirectChatHandler(c *gin.Context) {
 	var requestBody DirectChatRequest
-
-	err := c.BindJSON(&requestBody)
-	if err != nil {
-		log.Print("failed to bind json, ", err)
+	if !s.bindJSON(c, &requestBody) {
 		return
 	}
-	tokenString := c.GetHeader("Authorization")
-
-	hostUserID, err := ValidateToken(tokenString)
+	hostUserTable := currentPrincipal(c).User
+	destinationUserTable, err := s.store.ReadUserByUsername(requestBody.UserID)
 	if err != nil {
-		log.Printf("failed to find user by token: %v", err)
-	}
-	destinationUserTable, err := db.Mysql.ReadUserByUsername(requestBody.UserID)
-	if err != nil {
-		log.Printf("failed to read user: %v", err)
+		respondError(c, err)
+		return
 	}
 
-	hostUserTable, err := db.Mysql.ReadUser(hostUserID)
-
-	if err != nil {
-		log.Printf("failed to read user: %v", err)
-	}
 	var userTable []db.UserTable
 	userTable = append(userTable, hostUserTable, destinationUserTable)
-	chatID, err := db.Mysql.NewChat("", db.Direct, userTable)
+	existingChatID, err := s.store.CheckRepeatedDirectChat(userTable)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	chatID, err := s.store.NewChat("", db.Direct, userTable, "")
 	if err != nil {
-		log.Print("failed to create chat, ", err)
+		respondError(c, err)
 		return
 	}
+	if existingChatID == "" {
+		s.publishChatCreated(chatID, hostUserTable.Username+destinationUserTable.Username, db.Direct)
+	}
 	log.Print("direct chat created")
 	c.JSON(200, chatID)
 }
 
-func NewGroupChatHandler(c *gin.Context) {
+func (s *Server) NewGroupChatHandler(c *gin.Context) {
 	var requestBody GroupChatRequest
-	err := c.BindJSON(&requestBody)
-	if err != nil {
-		log.Print("failed to bind json, ", err)
+	if !s.bindJSON(c, &requestBody) {
 		return
 	}
-	tokenString := c.GetHeader("Authorization")
-
-	userID, err := ValidateToken(tokenString)
-	if err != nil {
-		log.Printf("failed to find user by token: %v", err)
-	}
+	userID := currentPrincipal(c).UserID
 	userTable := []db.UserTable{}
 	for _, v := range requestBody.Users {
-		user, err := db.Mysql.ReadUserByUsername(v.Username)
+		user, err := s.store.ReadUserByUsername(v.Username)
 		if err != nil {
-			log.Printf("failed to read user: %v", err)
+			respondError(c, err)
 			return
 		}
 		userTable = append(userTable, user)
@@ -82,73 +71,119 @@ func NewGroupChatHandler(c *gin.Context) {
 		}
 	}
 	if !validUser {
-		log.Printf("you're not allowed")
-		c.JSON(400, "Invalid token")
+		respondError(c, errValidation("the users of a group must include you"))
 		return
 	}
-	if len(userTable) == 0 {
-		log.Print("failed to create chat: no users provided")
+	chatID, err := s.store.NewChat(requestBody.ChatName, db.Group, userTable, userID)
+	if err != nil {
+		respondError(c, err)
 		return
 	}
-	log.Println(requestBody.ChatName)
-	chatID, err := db.Mysql.NewChat(requestBody.ChatName, db.Group, userTable)
+	// Unnamed groups are named after their members by NewChat.
+	chat, err := s.store.GetChat(chatID)
 	if err != nil {
-		log.Printf("failed to create chat: %v", err)
-		return
+		log.Printf("failed to read chat %s to announce it: %v", chatID, err)
+	} else {
+		s.publishChatCreated(chatID, chat.Name, db.Group)
 	}
 	c.JSON(200, chatID)
 }
 
-func GetChatMessagesHandler(c *gin.Context) {
+// GetChatMessagesHandler returns a page of the chat's messages, newest first.
+// Pass next_cursor back as ?before= to scroll further into the past and
+// prev_cursor as ?after= to fetch what is newer.
+func (s *Server) GetChatMessagesHandler(c *gin.Context) {
+	userID := currentPrincipal(c).UserID
 	chatID := c.Param("id")
-	messages, err := db.Mysql.GetChatMessages(chatID)
+	if _, ok := s.authorizeChat(c, userID, chatID, PermissionReadMessages); !ok {
+		return
+	}
+	cursor, err := s.parseMessageCursor(c)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	page, err := s.store.GetChatMessages(chatID, cursor)
 	if err != nil {
-		log.Printf("failed to get messages: %v", err)
-		c.JSON(400, "failed to get chat messages")
+		respondError(c, err)
 		return
 	}
-	c.JSON(200, messages)
+	response := ChatMessagesResponse{
+		Messages: make([]MessageResponse, 0, len(page.Messages)),
+	}
+	for _, message := range page.Messages {
+		response.Messages = append(response.Messages, convertMessageToResponse(message))
+	}
+	if len(page.Messages) > 0 {
+		if page.HasOlder {
+			response.NextCursor = &page.Messages[len(page.Messages)-1].ID
+		}
+		if page.HasNewer {
+			response.PrevCursor = &page.Messages[0].ID
+		}
+	}
+	c.JSON(200, response)
 
 }
 
-func GetUsersChatsHandler(c *gin.Context) {
-	tokenString := c.GetHeader("Authorization")
-
-	userID, err := ValidateToken(tokenString)
-	if err != nil {
-		log.Printf("failed to find user by token: %v", err)
+func (s *Server) parseMessageCursor(c *gin.Context) (db.MessageCursor, error) {
+	cursor := db.MessageCursor{Limit: s.config.Chat.MessagePageSize}
+	var err error
+	if before := c.Query("before"); before != "" {
+		if cursor.Before, err = strconv.Atoi(before); err != nil || cursor.Before < 1 {
+			return cursor, errInvalidRequest("before must be a message ID")
+		}
+	}
+	if after := c.Query("after"); after != "" {
+		if cursor.After, err = strconv.Atoi(after); err != nil || cursor.After < 1 {
+			return cursor, errInvalidRequest("after must be a message ID")
+		}
+	}
+	if cursor.Before > 0 && cursor.After > 0 {
+		return cursor, errInvalidRequest("before and after cannot be used together")
+	}
+	if limit := c.Query("limit"); limit != "" {
+		if cursor.Limit, err = strconv.Atoi(limit); err != nil || cursor.Limit < 1 {
+			return cursor, errInvalidRequest("limit must be a positive number")
+		}
+		if cursor.Limit > s.config.Chat.MaxMessagePageSize {
+			cursor.Limit = s.config.Chat.MaxMessagePageSize
+		}
 	}
-	chatMembers, err := db.Mysql.GetUsersChatMembers(userID)
+	return cursor, nil
+}
+
+func (s *Server) GetUsersChatsHandler(c *gin.Context) {
+	userID := currentPrincipal(c).UserID
+	chatMembers, err := s.store.GetUsersChatMembers(userID)
 	if err != nil {
-		log.Printf("failed to get users chats: %v", err)
+		respondError(c, err)
 		return
 	}
 
-	result, err := db.Mysql.GetUsersChatIDAndChatName(chatMembers)
+	result, err := s.store.GetUsersChatIDAndChatName(chatMembers)
 	if err != nil {
-		log.Printf("failed to get users chats: %v", err)
+		respondError(c, err)
 		return
 	}
 	c.JSON(200, result)
 }
 
-func DirectChatIDGenerator(users []db.User) (string, error) {
-	var userIDs []xid.ID
-	err := errors.New("too many users provided")
-	for _, user := range users {
-		userIDs = append(userIDs, user.ID)
-	}
-	if len(userIDs) > 2 {
-		log.Println("too many users for direct chat")
-		return "", err
-	}
-	var concatenatedID string
-	if userIDs[0].Compare(userIDs[1]) < 0 {
-		concatenatedID = userIDs[0].String() + userIDs[1].String()
-	} else {
-		concatenatedID = userIDs[1].String() + userIDs[0].String()
+// GetChatMembersHandler lists the users currently in the chat.
+func (s *Server) GetChatMembersHandler(c *gin.Context) {
+	userID := currentPrincipal(c).UserID
+	chatID := c.Param("id")
+	if _, ok := s.authorizeChat(c, userID, chatID, PermissionListMembers); !ok {
+		return
 	}
-	hashID := hash(concatenatedID)
-	return hashID, nil
-
+	members, err := s.store.GetChatMembers(chatID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	response := make([]ChatMemberResponse, 0, len(members))
+	for _, member := range members {
+		response = append(response, convertChatMemberToResponse(member))
+	}
+	c.JSON(http.StatusOK, response)
 }
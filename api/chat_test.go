@@ -0,0 +1,103 @@
+package api
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/mhghw/fara-message/db"
+)
+
+func TestGetChatMessagesCursors(t *testing.T) {
+	s, store := newTestServer(t)
+	alice := register(t, s, "alice")
+	register(t, s, "bobby")
+	var users []db.UserTable
+	for _, username := range []string{"alice", "bobby"} {
+		user, err := store.ReadUserByUsername(username)
+		if err != nil {
+			t.Fatal(err)
+		}
+		users = append(users, user)
+	}
+	chatID, err := store.NewChat("", db.Direct, users, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Messages 1 to 5, with 3 deleted; deleted messages are still listed.
+	for i := 0; i < 5; i++ {
+		if _, err := store.SendMessage(users[0].ID, chatID, "hello"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.DeleteMessage(db.Message{ID: 3}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		query    string
+		wantIDs  []int
+		wantNext int
+		wantPrev int
+	}{
+		{name: "latest", query: "?limit=2", wantIDs: []int{5, 4}, wantNext: 4},
+		{name: "before", query: "?limit=2&before=4", wantIDs: []int{3, 2}, wantNext: 2, wantPrev: 3},
+		{name: "before reaches the start", query: "?limit=2&before=2", wantIDs: []int{1}, wantPrev: 1},
+		{name: "after", query: "?limit=2&after=1", wantIDs: []int{3, 2}, wantNext: 2, wantPrev: 3},
+		{name: "after reaches the end", query: "?limit=2&after=3", wantIDs: []int{5, 4}, wantNext: 4},
+		{name: "after the last", query: "?after=5", wantIDs: []int{}},
+		{name: "everything", query: "", wantIDs: []int{5, 4, 3, 2, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := do(t, s, http.MethodGet, "/chat/"+chatID+tt.query, alice.AccessToken, nil)
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("got %d %s", recorder.Code, recorder.Body.String())
+			}
+			response := decode[ChatMessagesResponse](t, recorder)
+			ids := []int{}
+			for _, message := range response.Messages {
+				ids = append(ids, message.ID)
+			}
+			if !slices.Equal(ids, tt.wantIDs) {
+				t.Errorf("ids = %v, want %v", ids, tt.wantIDs)
+			}
+			if got := cursorValue(response.NextCursor); got != tt.wantNext {
+				t.Errorf("next_cursor = %d, want %d", got, tt.wantNext)
+			}
+			if got := cursorValue(response.PrevCursor); got != tt.wantPrev {
+				t.Errorf("prev_cursor = %d, want %d", got, tt.wantPrev)
+			}
+		})
+	}
+}
+
+func TestGetChatMessagesRejectsBadCursors(t *testing.T) {
+	s, store := newTestServer(t)
+	alice := register(t, s, "alice")
+	user, err := store.ReadUserByUsername("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	chatID, err := store.NewChat("notes", db.Group, []db.UserTable{user}, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, query := range []string{"?before=x", "?after=0", "?before=2&after=1", "?limit=0"} {
+		t.Run(query, func(t *testing.T) {
+			recorder := do(t, s, http.MethodGet, "/chat/"+chatID+query, alice.AccessToken, nil)
+			if recorder.Code != http.StatusBadRequest {
+				t.Errorf("got %d %s, want 400", recorder.Code, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func cursorValue(cursor *int) int {
+	if cursor == nil {
+		return 0
+	}
+	return *cursor
+}
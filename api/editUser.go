@@ -1,7 +1,6 @@
 package api
 
 import (
-	"log"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -9,41 +8,23 @@ import (
 )
 
 type Information struct {
-	Username  string `json:"username"`
-	Firstname string `json:"firstname"`
-	Lastname  string `json:"lastname"`
+	Firstname string `json:"firstname" validate:"name"`
+	Lastname  string `json:"lastname" validate:"name"`
 }
 
-func editUser(c *gin.Context) {
+// editUser changes the first and last name of the caller.
+func (s *Server) editUser(c *gin.Context) {
 	var userInfo Information
-
-	err := c.BindJSON(&userInfo)
-	if err != nil {
-		log.Printf("error binding JSON:%v", err)
-		c.Status(400)
-		return
-	}
-
-	if len(userInfo.Username) < 3 {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "the username is incorrect",
-		})
+	if !s.bindJSON(c, &userInfo) {
 		return
 	}
 
-	userUnderReview, err := db.Mysql.ReadUserByUsername(userInfo.Username)
-	if err != nil {
-		log.Printf("error getting username from database:%v", err)
-		c.Status(400)
-		return
-	}
-
-	userUnderReview.FirstName = userInfo.Firstname
-	userUnderReview.LastName = userInfo.Lastname
-	err = db.Mysql.UpdateUser(userUnderReview.ID, userUnderReview)
+	err := s.store.UpdateUser(currentPrincipal(c).UserID, db.UserTable{
+		FirstName: userInfo.Firstname,
+		LastName:  userInfo.Lastname,
+	})
 	if err != nil {
-		log.Printf("error updating user:%v", err)
-		c.Status(400)
+		respondError(c, err)
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{
@@ -0,0 +1,31 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestEditUserChangesOnlyTheCaller(t *testing.T) {
+	s, store := newTestServer(t)
+	alice := register(t, s, "alice")
+	register(t, s, "bobby")
+
+	recorder := do(t, s, http.MethodPost, "/user/edit", alice.AccessToken, map[string]string{
+		"username":  "bobby",
+		"firstname": "Alicia",
+		"lastname":  "Smith",
+	})
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("got %d %s", recorder.Code, recorder.Body.String())
+	}
+
+	for username, want := range map[string]string{"alice": "Alicia", "bobby": "First"} {
+		user, err := store.ReadUserByUsername(username)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.FirstName != want {
+			t.Errorf("first name of %s = %q, want %q", username, user.FirstName, want)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mhghw/fara-message/db"
+	"github.com/mhghw/fara-message/mail"
+)
+
+// New accounts and changed addresses start out unverified. The verification
+// link carries a random token that works once; like reset tokens only its
+// SHA-256 is stored, together with the address it was sent to, so a link for
+// an old address stops working. Unlike a signed token it outlives key
+// rotations and restarts.
+
+const verificationTokenBytes = 32
+
+type verifyEmailBody struct {
+	Token string `json:"token" validate:"required"`
+}
+
+type changeEmailBody struct {
+	Email           string `json:"email" validate:"required,email_address"`
+	CurrentPassword string `json:"current_password" validate:"required"`
+}
+
+// sendVerificationEmail mails a verification link for user's current
+// address.
+func (s *Server) sendVerificationEmail(user db.UserTable) error {
+	raw := make([]byte, verificationTokenBytes)
+	if _, err := rand.Read(raw); err != nil {
+		return fmt.Errorf("failed to generate token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+	now := time.Now()
+	err := s.store.CreateEmailVerificationToken(db.EmailVerificationToken{
+		ID:          hashToken(token),
+		UserTableID: user.ID,
+		Email:       user.Email,
+		CreatedTime: now,
+		ExpiresTime: now.Add(s.config.Auth.EmailVerificationLifetime.Std()),
+	})
+	if err != nil {
+		return err
+	}
+	var body strings.Builder
+	fmt.Fprintf(&body, "Hi %s,\n\nplease confirm that this is your email address.\n\n", user.Username)
+	if s.config.Auth.EmailVerificationURL != "" {
+		link, err := tokenLink(s.config.Auth.EmailVerificationURL, token)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&body, "Open this link to verify it:\n%s\n\n", link)
+	} else {
+		fmt.Fprintf(&body, "Your verification token is:\n%s\n\n", token)
+	}
+	fmt.Fprintf(&body, "This expires in %d hours. If you did not sign up, ignore this email.\n", int(s.config.Auth.EmailVerificationLifetime.Std().Hours()))
+
+	s.sendMail(mail.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body:    body.String(),
+	})
+	return nil
+}
+
+// RequireVerifiedEmail guards routes that new, unverified accounts must not
+// use yet. It has to run after AuthMiddlewareHandler.
+func (s *Server) RequireVerifiedEmail(c *gin.Context) {
+	if !currentPrincipal(c).HasRole(RoleVerified) {
+		respondError(c, newAPIError(http.StatusForbidden, CodeEmailNotVerified, "verify your email address first"))
+		return
+	}
+	c.Next()
+}
+
+func (s *Server) VerifyEmailHandler(c *gin.Context) {
+	var body verifyEmailBody
+	if !s.bindJSON(c, &body) {
+		return
+	}
+	userID, err := s.store.VerifyEmail(hashToken(body.Token))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	log.Printf("email address of user %s was verified", userID)
+	c.JSON(http.StatusOK, gin.H{"message": "email verified successfully"})
+}
+
+// ResendVerificationHandler mails a fresh verification link to the caller.
+func (s *Server) ResendVerificationHandler(c *gin.Context) {
+	user := currentPrincipal(c).User
+	if user.EmailVerifiedTime.Valid {
+		respondError(c, errConflict("email address is already verified"))
+		return
+	}
+	if err := s.sendVerificationEmail(user); err != nil {
+		respondError(c, fmt.Errorf("failed to send verification email: %w", err))
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"message": "verification email sent"})
+}
+
+// ChangeEmailHandler sets a new address, which has to be verified again.
+func (s *Server) ChangeEmailHandler(c *gin.Context) {
+	var body changeEmailBody
+	if !s.bindJSON(c, &body) {
+		return
+	}
+	// The principal's user is loaded without the password hash.
+	user, err := s.store.ReadUserByUsername(currentPrincipal(c).User.Username)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if !s.checkCurrentPassword(c, user, body.CurrentPassword) {
+		return
+	}
+	if err := s.store.UpdateEmail(user.ID, body.Email); err != nil {
+		respondError(c, err)
+		return
+	}
+	user.Email = body.Email
+	if err := s.sendVerificationEmail(user); err != nil {
+		log.Printf("failed to send verification email: %v", err)
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "email updated, check your inbox to verify it"})
+}
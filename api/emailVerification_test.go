@@ -0,0 +1,51 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/mhghw/fara-message/db"
+)
+
+// verifyEmail verifies the address of username through POST /email/verify.
+func verifyEmail(t *testing.T, s *Server, store *db.Database, username string) {
+	t.Helper()
+	user, err := store.ReadUserByUsername(username)
+	if err != nil {
+		t.Fatalf("ReadUserByUsername: %v", err)
+	}
+	token := "token-of-" + username
+	err = store.CreateEmailVerificationToken(db.EmailVerificationToken{
+		ID:          hashToken(token),
+		UserTableID: user.ID,
+		Email:       user.Email,
+		CreatedTime: time.Now(),
+		ExpiresTime: time.Now().Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatalf("CreateEmailVerificationToken: %v", err)
+	}
+	if recorder := do(t, s, http.MethodPost, "/email/verify", "", verifyEmailBody{Token: token}); recorder.Code != http.StatusOK {
+		t.Fatalf("verify email of %s: %d %s", username, recorder.Code, recorder.Body.String())
+	}
+	if recorder := do(t, s, http.MethodPost, "/email/verify", "", verifyEmailBody{Token: token}); recorder.Code != http.StatusBadRequest {
+		t.Fatalf("reused verification token: got %d %s, want 400", recorder.Code, recorder.Body.String())
+	}
+}
+
+func TestRequireVerifiedEmail(t *testing.T) {
+	s, store := newTestServer(t)
+	alice := register(t, s, "alice")
+	group := GroupChatRequest{ChatName: "friends", Users: []db.UserTable{{Username: "alice"}}}
+
+	recorder := do(t, s, http.MethodPost, "/chat/group", alice.AccessToken, group)
+	if recorder.Code != http.StatusForbidden || decode[ErrorResponse](t, recorder).Code != CodeEmailNotVerified {
+		t.Fatalf("unverified: got %d %s, want 403 %s", recorder.Code, recorder.Body.String(), CodeEmailNotVerified)
+	}
+
+	verifyEmail(t, s, store, "alice")
+	if recorder := do(t, s, http.MethodPost, "/chat/group", alice.AccessToken, group); recorder.Code != http.StatusOK {
+		t.Fatalf("verified: got %d %s", recorder.Code, recorder.Body.String())
+	}
+}
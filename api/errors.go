@@ -0,0 +1,139 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mhghw/fara-message/db"
+)
+
+// ErrorResponse is the body of every error response. Code is stable and
+// meant for programs, Message for people; Details is optional and depends
+// on the code.
+type ErrorResponse struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Details any    `json:"details,omitempty"`
+}
+
+const (
+	CodeInvalidRequest     = "invalid_request"
+	CodeValidationFailed   = "validation_failed"
+	CodeUnauthorized       = "unauthorized"
+	CodeInvalidCredentials = "invalid_credentials"
+	CodeForbidden          = "forbidden"
+	CodeEmailNotVerified   = "email_not_verified"
+	CodeNotFound           = "not_found"
+	CodeConflict           = "conflict"
+	CodePayloadTooLarge    = "payload_too_large"
+	CodeRateLimited        = "rate_limited"
+	CodeInternal           = "internal_error"
+)
+
+// APIError is an error that knows the response it should produce.
+type APIError struct {
+	Status  int
+	Code    string
+	Message string
+	Details any
+}
+
+func (e *APIError) Error() string {
+	return e.Message
+}
+
+func newAPIError(status int, code string, message string) *APIError {
+	return &APIError{Status: status, Code: code, Message: message}
+}
+
+func errInvalidRequest(message string) *APIError {
+	return newAPIError(http.StatusBadRequest, CodeInvalidRequest, message)
+}
+
+func errValidation(message string) *APIError {
+	return newAPIError(http.StatusBadRequest, CodeValidationFailed, message)
+}
+
+func errUnauthorized(message string) *APIError {
+	return newAPIError(http.StatusUnauthorized, CodeUnauthorized, message)
+}
+
+func errForbidden(message string) *APIError {
+	return newAPIError(http.StatusForbidden, CodeForbidden, message)
+}
+
+func errNotFound(message string) *APIError {
+	return newAPIError(http.StatusNotFound, CodeNotFound, message)
+}
+
+func errConflict(message string) *APIError {
+	return newAPIError(http.StatusConflict, CodeConflict, message)
+}
+
+var errInternal = newAPIError(http.StatusInternalServerError, CodeInternal, "internal server error")
+
+// respondError aborts the request with the response for err. An APIError
+// describes its own response and the kinds of db.Error map to 404, 409 and
+// 400. Anything else is a failure of ours: it is logged and the client only
+// learns that something went wrong.
+func respondError(c *gin.Context, err error) {
+	var apiErr *APIError
+	var dbErr *db.Error
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &apiErr):
+	case errors.As(err, &dbErr):
+		apiErr = convertDBError(dbErr)
+	case errors.As(err, &maxBytesErr):
+		apiErr = newAPIError(http.StatusRequestEntityTooLarge, CodePayloadTooLarge, "request body is too large")
+	default:
+		log.Printf("%s %s: %v", c.Request.Method, c.Request.URL.Path, err)
+		apiErr = errInternal
+	}
+	c.AbortWithStatusJSON(apiErr.Status, ErrorResponse{
+		Code:    apiErr.Code,
+		Message: apiErr.Message,
+		Details: apiErr.Details,
+	})
+}
+
+func convertDBError(err *db.Error) *APIError {
+	switch err.Kind {
+	case db.ErrNotFound:
+		return errNotFound(err.Message)
+	case db.ErrConflict:
+		return errConflict(err.Message)
+	default:
+		return errInvalidRequest(err.Message)
+	}
+}
+
+func convertBindError(err error) error {
+	var maxBytesErr *http.MaxBytesError
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &maxBytesErr):
+		return err
+	case errors.Is(err, io.EOF):
+		return errInvalidRequest("request body is empty")
+	case errors.As(err, &syntaxErr), errors.Is(err, io.ErrUnexpectedEOF):
+		return errInvalidRequest("request body is not valid JSON")
+	case errors.As(err, &typeErr):
+		apiErr := errInvalidRequest("request body has a field of the wrong type")
+		apiErr.Details = gin.H{"field": typeErr.Field, "expected": typeErr.Type.String()}
+		return apiErr
+	default:
+		return errInvalidRequest(err.Error())
+	}
+}
+
+// recoverPanic answers a panicking handler with a 500. gin has already
+// logged the panic by then.
+func recoverPanic(c *gin.Context, recovered any) {
+	respondError(c, errInternal)
+}
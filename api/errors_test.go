@@ -0,0 +1,114 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mhghw/fara-message/config"
+)
+
+func TestErrorEnvelope(t *testing.T) {
+	s, _ := newTestServer(t, func(cfg *config.Config) {
+		cfg.Server.MaxBodyBytes = 512
+	})
+	alice := register(t, s, "alice")
+
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		token       string
+		body        string
+		wantStatus  int
+		wantCode    string
+		wantMessage string
+		wantDetails bool
+	}{
+		{
+			name:   "unknown route",
+			method: http.MethodGet, path: "/no/such/route",
+			wantStatus: http.StatusNotFound, wantCode: CodeNotFound, wantMessage: "no such endpoint",
+		},
+		{
+			name:   "missing access token",
+			method: http.MethodGet, path: "/user/sessions",
+			wantStatus: http.StatusUnauthorized, wantCode: CodeUnauthorized, wantMessage: "an access token is required",
+		},
+		{
+			name:   "invalid JSON",
+			method: http.MethodPost, path: "/login", body: `{"username":`,
+			wantStatus: http.StatusBadRequest, wantCode: CodeInvalidRequest, wantMessage: "request body is not valid JSON",
+		},
+		{
+			name:   "wrong field type",
+			method: http.MethodPost, path: "/login", body: `{"username":1}`,
+			wantStatus: http.StatusBadRequest, wantCode: CodeInvalidRequest, wantDetails: true,
+		},
+		{
+			name:   "validation",
+			method: http.MethodPost, path: "/login", body: `{}`,
+			wantStatus: http.StatusBadRequest, wantCode: CodeValidationFailed, wantDetails: true,
+		},
+		{
+			name:   "body too large",
+			method: http.MethodPost, path: "/login", body: `{"username":"` + strings.Repeat("a", 1024) + `"}`,
+			wantStatus: http.StatusRequestEntityTooLarge, wantCode: CodePayloadTooLarge,
+		},
+		{
+			name:   "store not found",
+			method: http.MethodDelete, path: "/user/contact/nobody", token: alice.AccessToken,
+			wantStatus: http.StatusNotFound, wantCode: CodeNotFound, wantMessage: "contact not found",
+		},
+		{
+			name:   "store conflict",
+			method: http.MethodPost, path: "/register",
+			body:       `{"username":"alice","first_name":"First","last_name":"Last","password":"password1","confirm_password":"password1","gender":"female","date_of_birth":"1990-01-01","email":"alice@example.com"}`,
+			wantStatus: http.StatusConflict, wantCode: CodeConflict, wantMessage: "username is already taken",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			request.Header.Set("Content-Type", "application/json")
+			if tt.token != "" {
+				request.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			recorder := httptest.NewRecorder()
+			s.Handler().ServeHTTP(recorder, request)
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("got %d %s, want %d", recorder.Code, recorder.Body.String(), tt.wantStatus)
+			}
+			response := decode[ErrorResponse](t, recorder)
+			if response.Code != tt.wantCode {
+				t.Errorf("code = %q, want %q", response.Code, tt.wantCode)
+			}
+			if tt.wantMessage != "" && response.Message != tt.wantMessage {
+				t.Errorf("message = %q, want %q", response.Message, tt.wantMessage)
+			}
+			if (response.Details != nil) != tt.wantDetails {
+				t.Errorf("details = %v, want them: %v", response.Details, tt.wantDetails)
+			}
+		})
+	}
+}
+
+func TestRespondErrorHidesInternalErrors(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+
+	respondError(c, errors.New("connection refused by 10.0.0.7"))
+
+	if recorder.Code != http.StatusInternalServerError {
+		t.Fatalf("got %d, want 500", recorder.Code)
+	}
+	response := decode[ErrorResponse](t, recorder)
+	if response.Code != CodeInternal || response.Message != "internal server error" {
+		t.Errorf("got %+v", response)
+	}
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"log"
+
+	"github.com/mhghw/fara-message/db"
+	"github.com/mhghw/fara-message/realtime"
+)
+
+type MessageDeletedPayload struct {
+	ID     int    `json:"id"`
+	ChatID string `json:"chat_id"`
+}
+
+type ChatPayload struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Type int    `json:"type"`
+}
+
+// publishMessage pushes a newly stored message to every online member of its
+// chat, the sender's other connections included, and to alsoTo.
+func (s *Server) publishMessage(message db.Message, alsoTo ...string) {
+	s.publishToChat(message.ChatTableID, realtime.EventMessageCreated, convertMessageToResponse(message), alsoTo...)
+}
+
+func (s *Server) publishMessageEdited(message db.Message) {
+	s.publishToChat(message.ChatTableID, realtime.EventMessageEdited, convertMessageToResponse(message))
+}
+
+func (s *Server) publishMessageDeleted(message db.Message) {
+	s.publishToChat(message.ChatTableID, realtime.EventMessageDeleted, MessageDeletedPayload{
+		ID:     message.ID,
+		ChatID: message.ChatTableID,
+	})
+}
+
+func (s *Server) publishChatCreated(chatID string, name string, chatType db.ChatType) {
+	s.publishToChat(chatID, realtime.EventChatCreated, ChatPayload{
+		ID:   chatID,
+		Name: name,
+		Type: chatType.Int(),
+	})
+}
+
+func (s *Server) publishChatUpdated(chatID string, name string, chatType int8) {
+	s.publishToChat(chatID, realtime.EventChatUpdated, ChatPayload{
+		ID:   chatID,
+		Name: name,
+		Type: int(chatType),
+	})
+}
+
+// publishToChat sends the event to the chat's members and to alsoTo, such as
+// somebody who just left it.
+func (s *Server) publishToChat(chatID string, eventType string, data any, alsoTo ...string) {
+	members, err := s.store.GetChatMembers(chatID)
+	if err != nil {
+		log.Printf("failed to get chat members for delivery: %v", err)
+		return
+	}
+	userIDs := make([]string, 0, len(members)+len(alsoTo))
+	userIDs = append(userIDs, alsoTo...)
+	for _, member := range members {
+		userIDs = append(userIDs, member.UserTableID)
+	}
+	s.hub.Publish(userIDs, realtime.Event{
+		Type:   eventType,
+		ChatID: chatID,
+		Data:   data,
+	})
+}
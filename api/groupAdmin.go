@@ -0,0 +1,251 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mhghw/fara-message/db"
+)
+
+// Groups and channels have one owner, any number of admins and plain
+// members. Admins add and remove members and rename the chat; only the owner
+// appoints admins and hands the chat over. Every change shows up in the chat
+// as a system message, except subscribers coming and going in channels.
+
+type AddChatMemberRequest struct {
+	Username string `json:"username" validate:"required"`
+}
+
+type ChangeChatMemberRoleRequest struct {
+	Role string `json:"role" validate:"required,oneof=admin member"`
+}
+
+type RenameChatRequest struct {
+	Name string `json:"name" validate:"required,max=255"`
+}
+
+type TransferChatOwnershipRequest struct {
+	UserID string `json:"user_id" validate:"required"`
+}
+
+// AddChatMemberHandler adds a user to the group.
+func (s *Server) AddChatMemberHandler(c *gin.Context) {
+	principal := currentPrincipal(c)
+	chatID := c.Param("id")
+	var request AddChatMemberRequest
+	if !s.bindJSON(c, &request) {
+		return
+	}
+	member, ok := s.authorizeChat(c, principal.UserID, chatID, PermissionAddMembers)
+	if !ok {
+		return
+	}
+	user, err := s.store.ReadUserByUsername(request.Username)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if err := s.store.AddChatMember(chatID, user.ID); err != nil {
+		respondError(c, err)
+		return
+	}
+	if !isChannel(member.ChatTable) {
+		s.recordChatChange(principal.UserID, chatID, fmt.Sprintf("%s added %s", principal.User.Username, user.Username))
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "member added successfully"})
+}
+
+// RemoveChatMemberHandler removes a member from the group. Admins may remove
+// plain members, the owner anybody.
+func (s *Server) RemoveChatMemberHandler(c *gin.Context) {
+	principal := currentPrincipal(c)
+	chatID := c.Param("id")
+	targetID := c.Param("user_id")
+	if targetID == principal.UserID {
+		respondError(c, errInvalidRequest("use POST /chat/:id/leave to leave a chat"))
+		return
+	}
+	actor, ok := s.authorizeChat(c, principal.UserID, chatID, PermissionRemoveMembers)
+	if !ok {
+		return
+	}
+	target, user, err := s.chatMemberWithUser(chatID, targetID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if target.Role == db.RoleOwner {
+		respondError(c, errForbidden("the owner cannot be removed"))
+		return
+	}
+	if target.Role >= actor.Role {
+		respondError(c, errForbidden("only the owner can remove an admin"))
+		return
+	}
+	if err := s.store.RemoveChatMember(chatID, targetID); err != nil {
+		respondError(c, err)
+		return
+	}
+	if !isChannel(actor.ChatTable) {
+		s.recordChatChange(principal.UserID, chatID, fmt.Sprintf("%s removed %s", principal.User.Username, user.Username), targetID)
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "member removed successfully"})
+}
+
+// ChangeChatMemberRoleHandler promotes a member to admin or demotes an admin
+// to member.
+func (s *Server) ChangeChatMemberRoleHandler(c *gin.Context) {
+	principal := currentPrincipal(c)
+	chatID := c.Param("id")
+	targetID := c.Param("user_id")
+	var request ChangeChatMemberRoleRequest
+	if !s.bindJSON(c, &request) {
+		return
+	}
+	if _, ok := s.authorizeChat(c, principal.UserID, chatID, PermissionChangeRoles); !ok {
+		return
+	}
+	if targetID == principal.UserID {
+		respondError(c, errInvalidRequest("transfer ownership to give up the owner role"))
+		return
+	}
+	target, user, err := s.chatMemberWithUser(chatID, targetID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	role := db.RoleMember
+	change := fmt.Sprintf("%s removed %s as admin", principal.User.Username, user.Username)
+	if request.Role == "admin" {
+		role = db.RoleAdmin
+		change = fmt.Sprintf("%s made %s an admin", principal.User.Username, user.Username)
+	}
+	if target.Role == role {
+		respondError(c, errConflict(fmt.Sprintf("%s is already %s", user.Username, request.Role)))
+		return
+	}
+	if err := s.store.SetChatMemberRole(chatID, targetID, role); err != nil {
+		respondError(c, err)
+		return
+	}
+	s.recordChatChange(principal.UserID, chatID, change)
+	c.JSON(http.StatusOK, gin.H{"message": "role changed successfully"})
+}
+
+// RenameChatHandler gives the group or channel a new name.
+func (s *Server) RenameChatHandler(c *gin.Context) {
+	principal := currentPrincipal(c)
+	chatID := c.Param("id")
+	var request RenameChatRequest
+	if !s.bindJSON(c, &request) {
+		return
+	}
+	member, ok := s.authorizeChat(c, principal.UserID, chatID, PermissionRenameChat)
+	if !ok {
+		return
+	}
+	if err := s.store.RenameChat(chatID, request.Name); err != nil {
+		respondError(c, err)
+		return
+	}
+	kind := "group"
+	if isChannel(member.ChatTable) {
+		kind = "channel"
+	}
+	s.recordChatChange(principal.UserID, chatID, fmt.Sprintf("%s renamed the %s to %s", principal.User.Username, kind, request.Name))
+	s.publishChatUpdated(chatID, request.Name, member.ChatTable.Type)
+	c.JSON(http.StatusOK, gin.H{"message": "chat renamed successfully"})
+}
+
+// TransferChatOwnershipHandler makes another member the owner. The previous
+// owner stays on as an admin.
+func (s *Server) TransferChatOwnershipHandler(c *gin.Context) {
+	principal := currentPrincipal(c)
+	chatID := c.Param("id")
+	var request TransferChatOwnershipRequest
+	if !s.bindJSON(c, &request) {
+		return
+	}
+	if _, ok := s.authorizeChat(c, principal.UserID, chatID, PermissionTransferOwnership); !ok {
+		return
+	}
+	if request.UserID == principal.UserID {
+		respondError(c, errInvalidRequest("you already own this chat"))
+		return
+	}
+	_, user, err := s.chatMemberWithUser(chatID, request.UserID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if err := s.store.TransferChatOwnership(chatID, principal.UserID, request.UserID); err != nil {
+		respondError(c, err)
+		return
+	}
+	s.recordChatChange(principal.UserID, chatID, fmt.Sprintf("%s made %s the owner", principal.User.Username, user.Username))
+	c.JSON(http.StatusOK, gin.H{"message": "ownership transferred successfully"})
+}
+
+// LeaveChatHandler takes the caller out of the group or channel.
+func (s *Server) LeaveChatHandler(c *gin.Context) {
+	principal := currentPrincipal(c)
+	chatID := c.Param("id")
+	member, ok := s.authorizeChat(c, principal.UserID, chatID, PermissionLeaveChat)
+	if !ok {
+		return
+	}
+	if !s.leaveChat(c, member) {
+		return
+	}
+	if !isChannel(member.ChatTable) {
+		s.recordChatChange(principal.UserID, chatID, fmt.Sprintf("%s left", principal.User.Username), principal.UserID)
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "left the chat successfully"})
+}
+
+// leaveChat ends the membership and, when that fails, writes the error and
+// returns false. The owner has to hand the chat over first unless they are
+// the last one in it.
+func (s *Server) leaveChat(c *gin.Context, member db.ChatMember) bool {
+	if member.Role == db.RoleOwner {
+		members, err := s.store.GetChatMembers(member.ChatTableID)
+		if err != nil {
+			respondError(c, err)
+			return false
+		}
+		if len(members) > 1 {
+			respondError(c, errConflict("transfer ownership before leaving"))
+			return false
+		}
+	}
+	if err := s.store.RemoveChatMember(member.ChatTableID, member.UserTableID); err != nil {
+		respondError(c, err)
+		return false
+	}
+	return true
+}
+
+// chatMemberWithUser returns the membership of the user an action is aimed
+// at, together with the user.
+func (s *Server) chatMemberWithUser(chatID string, userID string) (db.ChatMember, db.UserTable, error) {
+	member, err := s.store.GetChatMember(chatID, userID)
+	if err != nil {
+		return member, db.UserTable{}, err
+	}
+	user, err := s.store.ReadUser(userID)
+	return member, user, err
+}
+
+// recordChatChange posts a system message about a change and pushes it to
+// the members and to alsoTo. The change has been made by then, so a failure
+// is only logged.
+func (s *Server) recordChatChange(actorID string, chatID string, change string, alsoTo ...string) {
+	message, err := s.store.SendSystemMessage(actorID, chatID, change)
+	if err != nil {
+		log.Printf("failed to record change to chat %s: %v", chatID, err)
+		return
+	}
+	s.publishMessage(message, alsoTo...)
+}
@@ -0,0 +1,196 @@
+package api
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mhghw/fara-message/db"
+)
+
+// Admins hand out invite links into their group or channel. Anyone with the
+// token can join through POST /chat/join/:token, or ask to join if the
+// invite requires approval. Only the SHA-256 of a token is stored, so the token is shown
+// once, when the invite is created.
+
+const inviteTokenBytes = 16
+
+type CreateChatInviteRequest struct {
+	// ExpiresIn is the lifetime in seconds; zero means the invite does not
+	// expire.
+	ExpiresIn int `json:"expires_in" validate:"min=0"`
+	// MaxUses is how many times the invite works; zero means any number.
+	MaxUses          int  `json:"max_uses" validate:"min=0"`
+	RequiresApproval bool `json:"requires_approval"`
+}
+
+// CreateChatInviteHandler creates an invite link into the group.
+func (s *Server) CreateChatInviteHandler(c *gin.Context) {
+	userID := currentPrincipal(c).UserID
+	chatID := c.Param("id")
+	var request CreateChatInviteRequest
+	if !s.bindJSON(c, &request) {
+		return
+	}
+	if _, ok := s.authorizeChat(c, userID, chatID, PermissionManageInvites); !ok {
+		return
+	}
+
+	raw := make([]byte, inviteTokenBytes)
+	if _, err := rand.Read(raw); err != nil {
+		respondError(c, fmt.Errorf("failed to generate token: %w", err))
+		return
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+	now := time.Now()
+	invite := db.ChatInvite{
+		ID:               generateID().String(),
+		TokenHash:        hashToken(token),
+		ChatTableID:      chatID,
+		CreatedBy:        userID,
+		CreatedTime:      now,
+		MaxUses:          request.MaxUses,
+		RequiresApproval: request.RequiresApproval,
+	}
+	if request.ExpiresIn > 0 {
+		invite.ExpiresTime = sql.NullTime{Time: now.Add(time.Duration(request.ExpiresIn) * time.Second), Valid: true}
+	}
+	if err := s.store.CreateChatInvite(invite); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	response := convertChatInviteToResponse(invite)
+	response.Token = token
+	if s.config.Chat.InviteURL != "" {
+		link, err := tokenLink(s.config.Chat.InviteURL, token)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		response.Link = link
+	}
+	c.JSON(http.StatusCreated, response)
+}
+
+// GetChatInvitesHandler lists the group's invites that still work.
+func (s *Server) GetChatInvitesHandler(c *gin.Context) {
+	userID := currentPrincipal(c).UserID
+	chatID := c.Param("id")
+	if _, ok := s.authorizeChat(c, userID, chatID, PermissionManageInvites); !ok {
+		return
+	}
+	invites, err := s.store.GetActiveChatInvites(chatID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	response := make([]ChatInviteResponse, 0, len(invites))
+	for _, invite := range invites {
+		response = append(response, convertChatInviteToResponse(invite))
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func (s *Server) RevokeChatInviteHandler(c *gin.Context) {
+	userID := currentPrincipal(c).UserID
+	chatID := c.Param("id")
+	if _, ok := s.authorizeChat(c, userID, chatID, PermissionManageInvites); !ok {
+		return
+	}
+	if err := s.store.RevokeChatInvite(chatID, c.Param("invite_id")); err != nil {
+		respondError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// JoinChatHandler lets the caller into the group of an invite, or files a
+// join request for the admins if the invite requires approval.
+func (s *Server) JoinChatHandler(c *gin.Context) {
+	principal := currentPrincipal(c)
+	invite, err := s.store.JoinChat(hashToken(c.Param("token")), principal.UserID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if invite.RequiresApproval {
+		c.JSON(http.StatusAccepted, gin.H{
+			"chat_id": invite.ChatTableID,
+			"message": "an admin has to approve your request",
+		})
+		return
+	}
+	chat, err := s.store.GetChat(invite.ChatTableID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if !isChannel(chat) {
+		s.recordChatChange(principal.UserID, invite.ChatTableID, fmt.Sprintf("%s joined using an invite link", principal.User.Username))
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"chat_id": invite.ChatTableID,
+		"message": "joined the chat successfully",
+	})
+}
+
+// GetChatJoinRequestsHandler lists the users waiting to be let into the
+// group.
+func (s *Server) GetChatJoinRequestsHandler(c *gin.Context) {
+	userID := currentPrincipal(c).UserID
+	chatID := c.Param("id")
+	if _, ok := s.authorizeChat(c, userID, chatID, PermissionManageInvites); !ok {
+		return
+	}
+	requests, err := s.store.GetChatJoinRequests(chatID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	response := make([]ChatJoinRequestResponse, 0, len(requests))
+	for _, request := range requests {
+		response = append(response, convertChatJoinRequestToResponse(request))
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func (s *Server) ApproveChatJoinRequestHandler(c *gin.Context) {
+	principal := currentPrincipal(c)
+	chatID := c.Param("id")
+	targetID := c.Param("user_id")
+	member, ok := s.authorizeChat(c, principal.UserID, chatID, PermissionManageInvites)
+	if !ok {
+		return
+	}
+	user, err := s.store.ReadUser(targetID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if err := s.store.ApproveChatJoinRequest(chatID, targetID); err != nil {
+		respondError(c, err)
+		return
+	}
+	if !isChannel(member.ChatTable) {
+		s.recordChatChange(principal.UserID, chatID, fmt.Sprintf("%s let %s join", principal.User.Username, user.Username))
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "join request approved"})
+}
+
+func (s *Server) RejectChatJoinRequestHandler(c *gin.Context) {
+	userID := currentPrincipal(c).UserID
+	chatID := c.Param("id")
+	if _, ok := s.authorizeChat(c, userID, chatID, PermissionManageInvites); !ok {
+		return
+	}
+	if err := s.store.RejectChatJoinRequest(chatID, c.Param("user_id")); err != nil {
+		respondError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
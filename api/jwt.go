@@ -3,26 +3,120 @@ package api
 import (
 	"errors"
 	"fmt"
-	"log"
 	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt"
+	"github.com/mhghw/fara-message/config"
 )
 
-var secretKey = []byte("farawin")
-
+// Claims of the tokens this server issues. exp, iat, iss, aud and jti are
+// the registered claims of RFC 7519.
 const (
-	TokenExpireTime = "expiration_time"
+	TokenExpiresAt  = "exp"
+	TokenIssuedAt   = "iat"
+	TokenIssuer     = "iss"
+	TokenAudience   = "aud"
+	TokenID         = "jti"
 	TokenUserID     = "user_id"
+	TokenSessionID  = "session_id"
+	TokenDeviceName = "device_name"
 )
 
-func CreateJWTToken(userID string) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+// tokenKind tells access tokens, MFA tokens and stream tickets apart by their
+// typ header and audience. An MFA token only proves the password was right
+// and a stream ticket only opens /ws or /events; neither is accepted in place
+// of an access token, here or by a service verifying with the published
+// keys.
+type tokenKind struct {
+	typ      string
+	audience string
+}
+
+// streamTicketLifetime is kept short because a ticket travels in the URL and
+// may end up in access logs.
+const streamTicketLifetime = 30 * time.Second
+
+// AccessClaims is what an access token says about its bearer. SessionID ties
+// it to the login it was issued for, TokenID lets it be revoked on its own.
+type AccessClaims struct {
+	UserID    string
+	SessionID string
+	TokenID   string
+	ExpiresAt time.Time
+}
+
+// MFAClaims carry a half-finished login over to POST /login/2fa.
+type MFAClaims struct {
+	UserID     string
+	DeviceName string
+	ExpiresAt  time.Time
+}
+
+// JWTManager signs access tokens with the current key of its keyring and
+// validates them against the key named in their kid header.
+type JWTManager struct {
+	keys        *Keyring
+	issuer      string
+	lifetime    time.Duration
+	mfaLifetime time.Duration
+
+	access tokenKind
+	mfa    tokenKind
+	stream tokenKind
+}
+
+func NewJWTManager(keys *Keyring, cfg config.Auth) *JWTManager {
+	return &JWTManager{
+		keys:        keys,
+		issuer:      cfg.TokenIssuer,
+		lifetime:    cfg.AccessTokenLifetime.Std(),
+		mfaLifetime: cfg.MFATokenLifetime.Std(),
+		// at+jwt is the type RFC 9068 gives access tokens.
+		access: tokenKind{typ: "at+jwt", audience: cfg.TokenAudience},
+		mfa:    tokenKind{typ: "mfa+jwt", audience: cfg.TokenIssuer + "/login/2fa"},
+		stream: tokenKind{typ: "stream+jwt", audience: cfg.TokenIssuer + "/stream"},
+	}
+}
+
+func (m *JWTManager) CreateJWTToken(userID string, sessionID string) (string, error) {
+	return m.sign(m.access, time.Now().Add(m.lifetime), jwt.MapClaims{
+		TokenUserID:    userID,
+		TokenSessionID: sessionID,
+		TokenID:        generateID().String(),
+	})
+}
+
+func (m *JWTManager) CreateMFAToken(userID string, deviceName string) (string, error) {
+	return m.sign(m.mfa, time.Now().Add(m.mfaLifetime), jwt.MapClaims{
 		TokenUserID:     userID,
-		TokenExpireTime: time.Now().Add(time.Hour * 24).Unix(),
+		TokenDeviceName: deviceName,
+	})
+}
+
+// CreateStreamTicket issues a ticket for opening a stream in the given
+// session. It is used up by the connection it opens.
+func (m *JWTManager) CreateStreamTicket(userID string, sessionID string) (string, time.Time, error) {
+	expiresAt := time.Now().Add(streamTicketLifetime)
+	ticket, err := m.sign(m.stream, expiresAt, jwt.MapClaims{
+		TokenUserID:    userID,
+		TokenSessionID: sessionID,
+		TokenID:        generateID().String(),
 	})
-	tokenString, err := token.SignedString(secretKey)
+	return ticket, expiresAt, err
+}
+
+// sign adds the registered claims for kind to claims and signs them.
+func (m *JWTManager) sign(kind tokenKind, expiresAt time.Time, claims jwt.MapClaims) (string, error) {
+	claims[TokenIssuer] = m.issuer
+	claims[TokenAudience] = kind.audience
+	claims[TokenIssuedAt] = time.Now().Unix()
+	claims[TokenExpiresAt] = expiresAt.Unix()
+	key := m.keys.current()
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["kid"] = key.id
+	token.Header["typ"] = kind.typ
+	tokenString, err := token.SignedString(key.private)
 	if err != nil {
 		return "", fmt.Errorf("error signing token: %w", err)
 	}
@@ -31,34 +125,92 @@ func CreateJWTToken(userID string) (string, error) {
 
 }
 
-func ValidateToken(tokenString string) (string, error) {
+// ParseToken checks the signature and expiry of an access token and returns
+// its claims. Whether the token or its session has been revoked is up to the
+// caller.
+func (m *JWTManager) ParseToken(tokenString string) (AccessClaims, error) {
+	return m.parseSessionToken(tokenString, m.access)
+}
+
+// ParseStreamTicket is ParseToken for stream tickets.
+func (m *JWTManager) ParseStreamTicket(ticket string) (AccessClaims, error) {
+	return m.parseSessionToken(ticket, m.stream)
+}
+
+func (m *JWTManager) parseSessionToken(tokenString string, kind tokenKind) (AccessClaims, error) {
+	claims, expirationTime, err := m.parse(tokenString, kind)
+	if err != nil {
+		return AccessClaims{}, err
+	}
+	userID, _ := claims[TokenUserID].(string)
+	sessionID, _ := claims[TokenSessionID].(string)
+	tokenID, _ := claims[TokenID].(string)
+	if userID == "" || sessionID == "" || tokenID == "" {
+		return AccessClaims{}, errors.New("token is missing claims")
+	}
 
+	return AccessClaims{
+		UserID:    userID,
+		SessionID: sessionID,
+		TokenID:   tokenID,
+		ExpiresAt: expirationTime,
+	}, nil
+}
+
+func (m *JWTManager) ParseMFAToken(tokenString string) (MFAClaims, error) {
+	claims, expirationTime, err := m.parse(tokenString, m.mfa)
+	if err != nil {
+		return MFAClaims{}, err
+	}
+	userID, _ := claims[TokenUserID].(string)
+	deviceName, _ := claims[TokenDeviceName].(string)
+	if userID == "" {
+		return MFAClaims{}, errors.New("token is missing claims")
+	}
+	return MFAClaims{
+		UserID:     userID,
+		DeviceName: deviceName,
+		ExpiresAt:  expirationTime,
+	}, nil
+}
+
+// parse verifies a token against the keyring and checks that it is of kind,
+// was issued by this server and has not expired.
+func (m *JWTManager) parse(tokenString string, kind tokenKind) (jwt.MapClaims, time.Time, error) {
 	tokenString = strings.TrimPrefix(tokenString, "Bearer ")
 	tokenString = strings.Trim(tokenString, `"`)
 
+	// jwt.Parse checks exp and iat when they are present.
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		return secretKey, nil
+		kid, _ := token.Header["kid"].(string)
+		key, err := m.keys.lookup(kid)
+		if err != nil {
+			return nil, err
+		}
+		if token.Method.Alg() != key.method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+		}
+		return key.verificationKey(), nil
 	})
 	if err != nil {
-		return "", fmt.Errorf("failed to parse token: %w", err)
+		return nil, time.Time{}, fmt.Errorf("failed to parse token: %w", err)
 	}
 	if !token.Valid {
-		return "", errors.New("invalid token")
+		return nil, time.Time{}, errors.New("invalid token")
+	}
+	if typ, _ := token.Header["typ"].(string); typ != kind.typ {
+		return nil, time.Time{}, fmt.Errorf("expected a %s token", kind.typ)
 	}
 	claims, ok := token.Claims.(jwt.MapClaims)
 	if !ok {
-		return "", errors.New("invalid claims format")
+		return nil, time.Time{}, errors.New("invalid claims format")
 	}
-	userIDString := claims[TokenUserID].(string)
-	if err != nil {
-		log.Printf("failed to convert user ID: %v", err)
-		return "", err
+	if !claims.VerifyIssuer(m.issuer, true) || !claims.VerifyAudience(kind.audience, true) {
+		return nil, time.Time{}, fmt.Errorf("token is not meant for %s", kind.audience)
 	}
-	expirationTimeUnix := claims[TokenExpireTime].(float64)
-	expirationTime := time.Unix(int64(expirationTimeUnix), 0)
-	if expirationTime.Before(time.Now()) {
-		return "", errors.New("token has expired")
+	expiresAt, _ := claims[TokenExpiresAt].(float64)
+	if _, ok := claims[TokenIssuedAt].(float64); !ok || expiresAt == 0 {
+		return nil, time.Time{}, errors.New("token is missing claims")
 	}
-
-	return userIDString, nil
+	return claims, time.Unix(int64(expiresAt), 0), nil
 }
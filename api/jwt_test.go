@@ -0,0 +1,74 @@
+package api
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+
+	"github.com/mhghw/fara-message/config"
+)
+
+func TestTokenKindsAreNotInterchangeable(t *testing.T) {
+	cfg := config.Default()
+	keys, err := NewKeyring(cfg.Auth.Signing, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens := NewJWTManager(keys, cfg.Auth)
+
+	access, err := tokens.CreateJWTToken("user", "session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mfa, err := tokens.CreateMFAToken("user", "phone")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ticket, _, err := tokens.CreateStreamTicket("user", "session")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := tokens.ParseToken(access); err != nil {
+		t.Errorf("access token: %v", err)
+	}
+	if _, err := tokens.ParseToken(mfa); err == nil {
+		t.Error("an MFA token was accepted as an access token")
+	}
+	if _, err := tokens.ParseToken(ticket); err == nil {
+		t.Error("a stream ticket was accepted as an access token")
+	}
+	if _, err := tokens.ParseStreamTicket(access); err == nil {
+		t.Error("an access token was accepted as a stream ticket")
+	}
+	if _, err := tokens.ParseMFAToken(access); err == nil {
+		t.Error("an access token was accepted as an MFA token")
+	}
+
+	other := cfg.Auth
+	other.TokenIssuer = "somebody-else"
+	if _, err := NewJWTManager(keys, other).ParseToken(access); err == nil {
+		t.Error("a token from another issuer was accepted")
+	}
+}
+
+func TestParseSigningKeyPinsAlgorithm(t *testing.T) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+
+	if _, err := parseSigningKey(data, config.AlgorithmEdDSA); err != nil {
+		t.Errorf("Ed25519 key for EdDSA: %v", err)
+	}
+	if _, err := parseSigningKey(data, config.AlgorithmRS256); err == nil {
+		t.Error("an Ed25519 key was loaded for RS256")
+	}
+}
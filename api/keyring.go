@@ -0,0 +1,395 @@
+package api
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt"
+	"github.com/mhghw/fara-message/config"
+)
+
+// Access tokens carry the ID of the key that signed them in their kid header.
+// The keyring holds the newest key, which signs, and the keys it replaced,
+// which keep verifying for the grace period so tokens signed just before a
+// rotation stay valid until they expire. Each key is bound to one algorithm
+// and a token claiming any other is rejected; keys for any algorithm but the
+// configured one are not loaded at all.
+
+const (
+	rsaKeyBits = 2048
+	// keyringRefreshInterval is how often the key directory is re-read to
+	// pick up keys rotated by other instances and to rotate when due.
+	keyringRefreshInterval = time.Minute
+	// keyringReloadBackoff limits how often an unknown kid makes the
+	// keyring re-read the key directory ahead of schedule.
+	keyringReloadBackoff = 10 * time.Second
+)
+
+var (
+	errUnknownSigningKey = errors.New("unknown signing key")
+	errRetiredSigningKey = errors.New("signing key has been retired")
+)
+
+type signingKey struct {
+	id     string
+	method jwt.SigningMethod
+	// private is an ed25519.PrivateKey, an *rsa.PrivateKey or, for HS256,
+	// the shared secret.
+	private crypto.PrivateKey
+	public  crypto.PublicKey
+	created time.Time
+	// retired is when a newer key replaced this one; zero for the newest.
+	retired time.Time
+}
+
+func (k *signingKey) verificationKey() interface{} {
+	if k.method == jwt.SigningMethodHS256 {
+		return k.private
+	}
+	return k.public
+}
+
+type Keyring struct {
+	algorithm        string
+	dir              string
+	rotationInterval time.Duration
+	gracePeriod      time.Duration
+
+	mu         sync.RWMutex
+	keys       []*signingKey // newest first
+	lastReload time.Time
+}
+
+// NewKeyring loads the keys in cfg.KeyDir, generating the first one if there
+// is none. With HS256 the keyring holds secret as its only key and never
+// rotates.
+func NewKeyring(cfg config.Signing, secret string) (*Keyring, error) {
+	k := &Keyring{
+		algorithm:        cfg.Algorithm,
+		dir:              cfg.KeyDir,
+		rotationInterval: cfg.RotationInterval.Std(),
+		gracePeriod:      cfg.GracePeriod.Std(),
+	}
+	if cfg.Algorithm == config.AlgorithmHS256 {
+		sum := sha256.Sum256([]byte(secret))
+		k.keys = []*signingKey{{
+			id:      "hs256-" + hex.EncodeToString(sum[:8]),
+			method:  jwt.SigningMethodHS256,
+			private: []byte(secret),
+			created: time.Now(),
+		}}
+		return k, nil
+	}
+
+	if k.dir == "" {
+		log.Printf("auth.signing.key_dir is not set, access tokens will not survive a restart")
+	} else {
+		if err := os.MkdirAll(k.dir, 0o700); err != nil {
+			return nil, fmt.Errorf("failed to create key directory: %w", err)
+		}
+		if err := k.Reload(); err != nil {
+			return nil, err
+		}
+	}
+	if len(k.keys) == 0 {
+		if err := k.Rotate(); err != nil {
+			return nil, err
+		}
+	}
+	return k, nil
+}
+
+// Reload replaces the keys with the ones in the key directory, ordered by
+// file modification time.
+func (k *Keyring) Reload() error {
+	entries, err := os.ReadDir(k.dir)
+	if err != nil {
+		return fmt.Errorf("failed to read key directory: %w", err)
+	}
+	var keys []*signingKey
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".pem" {
+			continue
+		}
+		path := filepath.Join(k.dir, entry.Name())
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read signing key: %w", err)
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return fmt.Errorf("failed to read signing key: %w", err)
+		}
+		key, err := parseSigningKey(data, k.algorithm)
+		if err != nil {
+			return fmt.Errorf("failed to parse signing key %s: %w", path, err)
+		}
+		key.id = strings.TrimSuffix(entry.Name(), ".pem")
+		key.created = info.ModTime()
+		keys = append(keys, key)
+	}
+	sortKeys(keys)
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.lastReload = time.Now()
+	if len(keys) == 0 && len(k.keys) > 0 {
+		return errors.New("key directory is empty")
+	}
+	k.keys = keys
+	return nil
+}
+
+// Rotate generates a new key, which signs from now on.
+func (k *Keyring) Rotate() error {
+	key, err := generateSigningKey(k.algorithm)
+	if err != nil {
+		return err
+	}
+	if k.dir != "" {
+		der, err := x509.MarshalPKCS8PrivateKey(key.private)
+		if err != nil {
+			return fmt.Errorf("failed to encode signing key: %w", err)
+		}
+		path := filepath.Join(k.dir, key.id+".pem")
+		tmp := path + ".tmp"
+		if err := os.WriteFile(tmp, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+			return fmt.Errorf("failed to write signing key: %w", err)
+		}
+		if err := os.Rename(tmp, path); err != nil {
+			return fmt.Errorf("failed to write signing key: %w", err)
+		}
+		log.Printf("generated signing key %s", key.id)
+		return k.Reload()
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	keys := []*signingKey{key}
+	for _, old := range k.keys {
+		if old.retired.IsZero() || time.Since(old.retired) < k.gracePeriod {
+			keys = append(keys, old)
+		}
+	}
+	sortKeys(keys)
+	k.keys = keys
+	log.Printf("generated signing key %s", key.id)
+	return nil
+}
+
+// RotateIfDue rotates once the newest key is older than the rotation
+// interval.
+func (k *Keyring) RotateIfDue() error {
+	if k.algorithm == config.AlgorithmHS256 || k.rotationInterval == 0 {
+		return nil
+	}
+	if time.Since(k.current().created) < k.rotationInterval {
+		return nil
+	}
+	return k.Rotate()
+}
+
+// run keeps the keyring in step with the key directory until ctx is done.
+func (k *Keyring) run(ctx context.Context) {
+	if k.algorithm == config.AlgorithmHS256 {
+		return
+	}
+	ticker := time.NewTicker(keyringRefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if k.dir != "" {
+			if err := k.Reload(); err != nil {
+				log.Printf("failed to reload signing keys: %v", err)
+				continue
+			}
+		}
+		if err := k.RotateIfDue(); err != nil {
+			log.Printf("failed to rotate signing key: %v", err)
+		}
+	}
+}
+
+// current returns the key that signs new tokens.
+func (k *Keyring) current() *signingKey {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.keys[0]
+}
+
+// lookup returns the key with the given ID if it may still verify tokens.
+func (k *Keyring) lookup(id string) (*signingKey, error) {
+	key, reload := k.find(id)
+	if key == nil && reload {
+		if err := k.Reload(); err != nil {
+			log.Printf("failed to reload signing keys: %v", err)
+		}
+		key, _ = k.find(id)
+	}
+	if key == nil {
+		return nil, errUnknownSigningKey
+	}
+	if !key.retired.IsZero() && time.Since(key.retired) >= k.gracePeriod {
+		return nil, errRetiredSigningKey
+	}
+	return key, nil
+}
+
+// find reports the key with the given ID, or whether the key directory is
+// worth re-reading because another instance may have rotated.
+func (k *Keyring) find(id string) (*signingKey, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	for _, key := range k.keys {
+		if key.id == id {
+			return key, false
+		}
+	}
+	return nil, k.dir != "" && time.Since(k.lastReload) > keyringReloadBackoff
+}
+
+func sortKeys(keys []*signingKey) {
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].created.After(keys[j].created)
+	})
+	for i, key := range keys {
+		key.retired = time.Time{}
+		if i > 0 {
+			key.retired = keys[i-1].created
+		}
+	}
+}
+
+func generateSigningKey(algorithm string) (*signingKey, error) {
+	key := &signingKey{id: generateID().String(), created: time.Now()}
+	switch algorithm {
+	case config.AlgorithmEdDSA:
+		public, private, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate signing key: %w", err)
+		}
+		key.method, key.private, key.public = jwt.SigningMethodEdDSA, private, public
+	case config.AlgorithmRS256:
+		private, err := rsa.GenerateKey(rand.Reader, rsaKeyBits)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate signing key: %w", err)
+		}
+		key.method, key.private, key.public = jwt.SigningMethodRS256, private, &private.PublicKey
+	default:
+		return nil, fmt.Errorf("cannot generate keys for %s", algorithm)
+	}
+	return key, nil
+}
+
+// parseSigningKey reads a PKCS #8 or PKCS #1 PEM private key for algorithm.
+// Ed25519 keys sign EdDSA and RSA keys RS256; a key of the other type is
+// rejected rather than trusted with the algorithm it implies.
+func parseSigningKey(data []byte, algorithm string) (*signingKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	var private any
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		private, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		private, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var key *signingKey
+	switch private := private.(type) {
+	case ed25519.PrivateKey:
+		key = &signingKey{method: jwt.SigningMethodEdDSA, private: private, public: private.Public()}
+	case *rsa.PrivateKey:
+		if private.N.BitLen() < rsaKeyBits {
+			return nil, fmt.Errorf("RSA keys must have at least %d bits", rsaKeyBits)
+		}
+		key = &signingKey{method: jwt.SigningMethodRS256, private: private, public: &private.PublicKey}
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", private)
+	}
+	if key.method.Alg() != algorithm {
+		return nil, fmt.Errorf("%s key does not match the configured algorithm %s", key.method.Alg(), algorithm)
+	}
+	return key, nil
+}
+
+// JWK is the public half of a signing key as described in RFC 7517.
+type JWK struct {
+	KeyType   string `json:"kty"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public keys that currently verify tokens. A shared HS256
+// secret is never published.
+func (k *Keyring) JWKS() JWKSet {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	set := JWKSet{Keys: []JWK{}}
+	for _, key := range k.keys {
+		if !key.retired.IsZero() && time.Since(key.retired) >= k.gracePeriod {
+			continue
+		}
+		jwk := JWK{Use: "sig", Algorithm: key.method.Alg(), KeyID: key.id}
+		switch public := key.public.(type) {
+		case ed25519.PublicKey:
+			jwk.KeyType, jwk.Curve = "OKP", "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		default:
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
+
+// JWKSHandler serves the keyring's public keys so other services can verify
+// access tokens without sharing a secret.
+func (s *Server) JWKSHandler(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, s.keys.JWKS())
+}
@@ -1,58 +1,90 @@
 package api
 
 import (
-	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"github.com/mhghw/fara-message/db"
+	"github.com/mhghw/fara-message/throttle"
 )
 
+var errInvalidCredentials = newAPIError(http.StatusUnauthorized, CodeInvalidCredentials, "the username or password is incorrect")
+
+// loginBody only requires its fields: the username and password rules may
+// have changed since an account was created.
 type loginBody struct {
-	Username string `json:"username"`
-	Password string `json:"password"`
+	Username string `json:"username" validate:"required"`
+	Password string `json:"password" validate:"required"`
+	// DeviceName labels the session in GET /user/sessions.
+	DeviceName string `json:"device_name"`
 }
 
-func loginHandler(c *gin.Context) {
+func (s *Server) loginHandler(c *gin.Context) {
 	var loginBody loginBody
-	err := c.BindJSON(&loginBody)
-	if err != nil {
-		log.Printf("error binding JSON:%v", err)
-		c.Status(400)
+	if !s.bindJSON(c, &loginBody) {
 		return
 	}
 
-	errIncorrectUserOrPass := HTTPError{Message: "the username or password is incorrect"}
-	errIncorrectUserOrPassJSON, errInMarshalling := json.Marshal(errIncorrectUserOrPass)
-	if errInMarshalling != nil {
-		log.Printf("error:%v", errInMarshalling)
+	account := throttle.AccountKey(loginBody.Username)
+	if !s.checkLoginThrottle(c, account) {
 		return
 	}
 
-	if len(loginBody.Username) < 3 || len(loginBody.Password) < 8 {
-		c.JSON(http.StatusBadRequest, string(errIncorrectUserOrPassJSON))
+	//checking entered data with data that is already stored
+	userUnderReview, err := s.store.ReadUserByUsername(loginBody.Username)
+	if err != nil && !errors.Is(err, db.ErrNotFound) {
+		respondError(c, err)
+		return
+	}
+	// An unknown username is checked against a dummy hash so that it takes
+	// as long as a wrong password.
+	passwordHash := userUnderReview.Password
+	if err != nil {
+		passwordHash = s.dummyPasswordHash
+	}
+	match, needsRehash, verifyErr := s.passwords.Verify(loginBody.Password, passwordHash)
+	if verifyErr != nil {
+		log.Printf("failed to verify password of user %s: %v", userUnderReview.ID, verifyErr)
+	}
+	if err != nil || !match {
+		s.loginFailed(c, account, userUnderReview.ID, loginBody.Username, errInvalidCredentials)
 		return
 	}
+	s.loginSucceeded(c, account, userUnderReview.ID, loginBody.Username)
+	if needsRehash {
+		s.rehashPassword(userUnderReview.ID, loginBody.Password)
+	}
 
-	//checking entered data with data that is already stored
-	userUnderReview, err := db.Mysql.ReadUserByUsername(loginBody.Username)
+	twoFactor, err := s.twoFactorEnabled(userUnderReview.ID)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, string(errIncorrectUserOrPassJSON))
+		respondError(c, err)
 		return
 	}
-	if hash(loginBody.Password) != userUnderReview.Password {
-		c.JSON(http.StatusOK, gin.H{
-			"message": "username or password are incorrect",
-		})
+	if twoFactor {
+		s.mfaChallenge(c, userUnderReview.ID, loginBody.DeviceName)
 		return
 	}
 
-	token, err := CreateJWTToken(userUnderReview.ID)
+	tokens, err := s.issueTokens(c, userUnderReview.ID, loginBody.DeviceName)
 	if err != nil {
-		log.Printf("failed to create token: %v", err)
+		respondError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, token)
+	c.JSON(http.StatusOK, tokens)
+}
+
+// rehashPassword replaces a legacy or outdated hash after a successful
+// login. Failing to do so is not the user's problem, so it only logs.
+func (s *Server) rehashPassword(userID string, password string) {
+	hashedPassword, err := s.passwords.Hash(password)
+	if err != nil {
+		log.Printf("failed to rehash password: %v", err)
+		return
+	}
+	if err := s.store.UpdateUser(userID, db.UserTable{Password: hashedPassword}); err != nil {
+		log.Printf("failed to store rehashed password: %v", err)
+	}
 }
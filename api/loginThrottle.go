@@ -0,0 +1,109 @@
+package api
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mhghw/fara-message/config"
+	"github.com/mhghw/fara-message/db"
+	"github.com/mhghw/fara-message/throttle"
+)
+
+// newLoginLimiter keeps failed attempts in memory, which is enough for a
+// single instance. Several instances behind a load balancer need a shared
+// throttle.Store instead.
+func newLoginLimiter(cfg config.LoginThrottle) *throttle.LoginLimiter {
+	account := throttle.LoginPolicy{
+		Window:           cfg.Window.Std(),
+		DelayAfter:       cfg.DelayAfter,
+		BaseDelay:        cfg.BaseDelay.Std(),
+		MaxDelay:         cfg.MaxDelay.Std(),
+		LockoutThreshold: cfg.LockoutThreshold,
+		LockoutDuration:  cfg.LockoutDuration.Std(),
+	}
+	// Many users can share an address, so an IP is never slowed down, only
+	// locked once it has far more failures than any one account may.
+	ip := throttle.LoginPolicy{
+		Window:           cfg.Window.Std(),
+		LockoutThreshold: cfg.IPLockoutThreshold,
+		LockoutDuration:  cfg.LockoutDuration.Std(),
+	}
+	return throttle.NewLoginLimiter(throttle.NewMemoryStore(), account, ip)
+}
+
+// checkLoginThrottle counts an attempt for key, one of the throttle.*Key
+// values, and answers with 429 and returns false when key or the client's IP
+// has to wait before trying again. A failing store lets the attempt through
+// rather than locking everybody out.
+func (s *Server) checkLoginThrottle(c *gin.Context, key string) bool {
+	verdict, err := s.loginLimiter.Check(c.Request.Context(), key, c.ClientIP())
+	if err != nil {
+		log.Printf("failed to check login throttle: %v", err)
+		return true
+	}
+	if verdict.RetryAfter <= 0 {
+		return true
+	}
+	tooManyAttempts(c, verdict)
+	return false
+}
+
+// loginFailed audits a failed attempt and answers with failure, or with 429
+// when this failure locked the key or IP.
+func (s *Server) loginFailed(c *gin.Context, key string, userID string, username string, failure *APIError) {
+	verdict, err := s.loginLimiter.Fail(c.Request.Context(), key, c.ClientIP())
+	if err != nil {
+		log.Printf("failed to record failed login: %v", err)
+	}
+	s.audit(c, db.AuditLoginFailed, userID, username)
+	if verdict.Locked {
+		s.audit(c, db.AuditLoginLocked, userID, username)
+		tooManyAttempts(c, verdict)
+		return
+	}
+	respondError(c, failure)
+}
+
+func (s *Server) loginSucceeded(c *gin.Context, key string, userID string, username string) {
+	s.clearLoginThrottle(c, key)
+	s.audit(c, db.AuditLoginSucceeded, userID, username)
+}
+
+// clearLoginThrottle takes back the attempt checkLoginThrottle counted once
+// it turned out to be right.
+func (s *Server) clearLoginThrottle(c *gin.Context, key string) {
+	if err := s.loginLimiter.Succeed(c.Request.Context(), key, c.ClientIP()); err != nil {
+		log.Printf("failed to reset login throttle: %v", err)
+	}
+}
+
+func tooManyAttempts(c *gin.Context, verdict throttle.Verdict) {
+	c.Header("Retry-After", strconv.Itoa(ceilSeconds(verdict.RetryAfter)))
+	message := "too many failed attempts, try again later"
+	if verdict.Locked {
+		message = "too many failed attempts, temporarily locked"
+	}
+	apiErr := newAPIError(http.StatusTooManyRequests, CodeRateLimited, message)
+	apiErr.Details = gin.H{"retry_after": ceilSeconds(verdict.RetryAfter), "locked": verdict.Locked}
+	respondError(c, apiErr)
+}
+
+// audit writes an audit entry. userID is empty for accounts that do not
+// exist. Failing to write one only logs.
+func (s *Server) audit(c *gin.Context, event string, userID string, username string) {
+	entry := db.AuditEntry{
+		ID:          generateID().String(),
+		Event:       event,
+		UserTableID: sql.NullString{String: userID, Valid: userID != ""},
+		Username:    username,
+		IPAddress:   c.ClientIP(),
+		CreatedTime: time.Now(),
+	}
+	if err := s.store.CreateAuditEntry(entry); err != nil {
+		log.Printf("failed to write audit entry %s: %v", event, err)
+	}
+}
@@ -0,0 +1,38 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/mhghw/fara-message/mail"
+)
+
+const mailSendTimeout = 30 * time.Second
+
+// sendMail sends message in the background. Besides not holding up the
+// request, this keeps the response time from telling whether an email went
+// out.
+func (s *Server) sendMail(message mail.Message) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), mailSendTimeout)
+		defer cancel()
+		if err := s.mailer.Send(ctx, message); err != nil {
+			log.Printf("failed to send email %q: %v", message.Subject, err)
+		}
+	}()
+}
+
+// tokenLink appends token to baseURL as the token query parameter.
+func tokenLink(baseURL string, token string) (string, error) {
+	link, err := url.Parse(baseURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid link URL: %w", err)
+	}
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+	return link.String(), nil
+}
@@ -1,80 +1,156 @@
 package api
 
 import (
-	"log"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/mhghw/fara-message/db"
 )
 
 type Message struct {
 	ID      string `json:"id"`
-	ChatID  string `json:"chatID"`
-	Content string `json:"content"`
+	ChatID  string `json:"chatID" validate:"required"`
+	Content string `json:"content" validate:"required"`
 }
 
-func SendMessageHandler(c *gin.Context) {
+type DeleteMessageRequest struct {
+	ID string `json:"id" validate:"required,numeric"`
+}
+
+type EditMessageRequest struct {
+	Content string `json:"content" validate:"required"`
+}
+
+type MessageRevisionResponse struct {
+	Content     string    `json:"content"`
+	CreatedTime time.Time `json:"created_time"`
+}
+
+type MessageRevisionsResponse struct {
+	Message   MessageResponse           `json:"message"`
+	Revisions []MessageRevisionResponse `json:"revisions"`
+}
+
+func (s *Server) SendMessageHandler(c *gin.Context) {
 	var message Message
-	if err := c.BindJSON(&message); err != nil {
-		log.Printf("error binding json:%v", err)
-		c.Status(400)
+	if !s.bindJSON(c, &message) {
 		return
 	}
 
-	authorizationHeader := c.GetHeader("Authorization")
-	userID, err := ValidateToken(authorizationHeader)
-	if err != nil {
-		log.Printf("error get ID:%v", err)
-		c.Status(400)
+	userID := currentPrincipal(c).UserID
+
+	if _, ok := s.authorizeChat(c, userID, message.ChatID, PermissionSendMessages); !ok {
 		return
 	}
 
-	err = db.Mysql.SendMessage(userID, message.ChatID, message.Content)
+	dbMessage, err := s.store.SendMessage(userID, message.ChatID, message.Content)
 	if err != nil {
-		log.Printf("error:%v", err)
-		c.Status(400)
+		respondError(c, err)
 		return
 	}
+	s.publishMessage(dbMessage)
 	c.JSON(http.StatusOK, gin.H{
 		"message": "message sent successfully",
 	})
 }
 
-func DeleteMessageHandler(c *gin.Context) {
-	authorizationHeader := c.GetHeader("Authorization")
-	userID, err := ValidateToken(authorizationHeader)
-	if err != nil {
-		log.Printf("error get ID:%v", err)
-		c.Status(400)
-		return
-	}
+func (s *Server) DeleteMessageHandler(c *gin.Context) {
+	userID := currentPrincipal(c).UserID
 
-	var message Message
-	if err := c.BindJSON(&message); err != nil {
-		log.Printf("error binding JSON:%v", err)
+	var message DeleteMessageRequest
+	if !s.bindJSON(c, &message) {
+		return
 	}
 	messageID, err := strconv.Atoi(message.ID)
 	if err != nil {
-		log.Printf("error converting string ID to int: %v", err)
-		c.JSON(400, "error converting string ID to int")
+		respondError(c, errInvalidRequest("invalid message ID"))
 		return
 	}
-	dbMessage, err := db.Mysql.GetUserMessage(messageID, userID)
+	dbMessage, err := s.store.GetUserMessage(messageID, userID)
 	if err != nil {
-		log.Printf("error finding message with provided message and user ID: %v", err)
-		c.JSON(400, "error finding message with provided message and user ID")
+		respondError(c, err)
 		return
-
 	}
-	err = db.Mysql.DeleteMessage(dbMessage)
+	if _, ok := s.authorizeChat(c, userID, dbMessage.ChatTableID, PermissionDeleteMessages); !ok {
+		return
+	}
+	err = s.store.DeleteMessage(dbMessage)
 	if err != nil {
-		log.Printf("error:%v", err)
-		c.Status(400)
+		respondError(c, err)
 		return
 	}
+	s.publishMessageDeleted(dbMessage)
 	c.JSON(http.StatusOK, gin.H{
 		"message": "message deleted successfully",
 	})
 }
+
+// EditMessageHandler lets the sender change a message's content. The previous
+// content is kept as a revision.
+func (s *Server) EditMessageHandler(c *gin.Context) {
+	userID := currentPrincipal(c).UserID
+	messageID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondError(c, errInvalidRequest("invalid message ID"))
+		return
+	}
+	var request EditMessageRequest
+	if !s.bindJSON(c, &request) {
+		return
+	}
+
+	original, err := s.store.GetUserMessage(messageID, userID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if _, ok := s.authorizeChat(c, userID, original.ChatTableID, PermissionSendMessages); !ok {
+		return
+	}
+
+	message, err := s.store.EditMessage(messageID, userID, request.Content)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	s.publishMessageEdited(message)
+	c.JSON(http.StatusOK, convertMessageToResponse(message))
+}
+
+// GetMessageRevisionsHandler returns a message with its earlier contents to
+// members of the message's chat.
+func (s *Server) GetMessageRevisionsHandler(c *gin.Context) {
+	userID := currentPrincipal(c).UserID
+	messageID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondError(c, errInvalidRequest("invalid message ID"))
+		return
+	}
+
+	message, err := s.store.GetMessage(messageID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if _, ok := s.authorizeChat(c, userID, message.ChatTableID, PermissionReadMessages); !ok {
+		return
+	}
+
+	revisions, err := s.store.GetMessageRevisions(messageID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	response := MessageRevisionsResponse{
+		Message:   convertMessageToResponse(message),
+		Revisions: make([]MessageRevisionResponse, 0, len(revisions)),
+	}
+	for _, revision := range revisions {
+		response.Revisions = append(response.Revisions, MessageRevisionResponse{
+			Content:     revision.Content,
+			CreatedTime: revision.CreatedTime,
+		})
+	}
+	c.JSON(http.StatusOK, response)
+}
@@ -6,8 +6,157 @@ import (
 	"github.com/mhghw/fara-message/db"
 )
 
-type HTTPError struct {
-	Message string `json:"message"`
+// MessageResponse is how a message leaves the API. Deleted messages keep
+// their place in the history but lose their content.
+type MessageResponse struct {
+	ID          int        `json:"id"`
+	ChatID      string     `json:"chat_id"`
+	SenderID    string     `json:"sender_id"`
+	Username    string     `json:"username"`
+	Type        string     `json:"type"`
+	Content     string     `json:"content"`
+	CreatedTime *time.Time `json:"created_time"`
+	EditedTime  *time.Time `json:"edited_time,omitempty"`
+	DeletedTime *time.Time `json:"deleted_time,omitempty"`
+}
+
+func convertMessageToResponse(message db.Message) MessageResponse {
+	response := MessageResponse{
+		ID:       message.ID,
+		ChatID:   message.ChatTableID,
+		SenderID: message.UserTableID,
+		Username: message.UserTable.Username,
+		Type:     message.Type.String(),
+		Content:  message.Content,
+	}
+	if !message.CreatedTime.IsZero() {
+		response.CreatedTime = &message.CreatedTime
+	}
+	if message.EditedTime.Valid {
+		response.EditedTime = &message.EditedTime.Time
+	}
+	if message.DeletedTime.Valid {
+		response.DeletedTime = &message.DeletedTime.Time
+		response.Content = ""
+	}
+	return response
+}
+
+type ChatMessagesResponse struct {
+	Messages []MessageResponse `json:"messages"`
+	// NextCursor is the ID to pass as ?before= for older messages.
+	NextCursor *int `json:"next_cursor,omitempty"`
+	// PrevCursor is the ID to pass as ?after= for newer messages.
+	PrevCursor *int `json:"prev_cursor,omitempty"`
+}
+
+type ChatMemberResponse struct {
+	UserID     string    `json:"user_id"`
+	Username   string    `json:"username"`
+	FirstName  string    `json:"first_name"`
+	LastName   string    `json:"last_name"`
+	Role       string    `json:"role"`
+	JoinedTime time.Time `json:"joined_time"`
+}
+
+func convertChatMemberToResponse(member db.ChatMember) ChatMemberResponse {
+	return ChatMemberResponse{
+		UserID:     member.UserTableID,
+		Username:   member.UserTable.Username,
+		FirstName:  member.UserTable.FirstName,
+		LastName:   member.UserTable.LastName,
+		Role:       member.Role.String(),
+		JoinedTime: member.JoinedTime,
+	}
+}
+
+type ChannelResponse struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Handle      string `json:"handle"`
+	Subscribers int64  `json:"subscribers"`
+}
+
+func convertChannelToResponse(channel db.ChannelListing) ChannelResponse {
+	return ChannelResponse{
+		ID:          channel.ID,
+		Name:        channel.Name,
+		Handle:      channel.Handle.String,
+		Subscribers: channel.Subscribers,
+	}
+}
+
+// ChatInviteResponse describes an invite link. Token and Link are only
+// known when the invite is created.
+type ChatInviteResponse struct {
+	ID               string     `json:"id"`
+	ChatID           string     `json:"chat_id"`
+	Token            string     `json:"token,omitempty"`
+	Link             string     `json:"link,omitempty"`
+	CreatedBy        string     `json:"created_by"`
+	CreatedTime      time.Time  `json:"created_time"`
+	ExpiresTime      *time.Time `json:"expires_time"`
+	MaxUses          int        `json:"max_uses"`
+	Uses             int        `json:"uses"`
+	RequiresApproval bool       `json:"requires_approval"`
+}
+
+func convertChatInviteToResponse(invite db.ChatInvite) ChatInviteResponse {
+	response := ChatInviteResponse{
+		ID:               invite.ID,
+		ChatID:           invite.ChatTableID,
+		CreatedBy:        invite.CreatedBy,
+		CreatedTime:      invite.CreatedTime,
+		MaxUses:          invite.MaxUses,
+		Uses:             invite.Uses,
+		RequiresApproval: invite.RequiresApproval,
+	}
+	if invite.ExpiresTime.Valid {
+		response.ExpiresTime = &invite.ExpiresTime.Time
+	}
+	return response
+}
+
+type ChatJoinRequestResponse struct {
+	UserID      string    `json:"user_id"`
+	Username    string    `json:"username"`
+	InviteID    string    `json:"invite_id"`
+	CreatedTime time.Time `json:"created_time"`
+}
+
+func convertChatJoinRequestToResponse(request db.ChatJoinRequest) ChatJoinRequestResponse {
+	return ChatJoinRequestResponse{
+		UserID:      request.UserTableID,
+		Username:    request.UserTable.Username,
+		InviteID:    request.ChatInviteID,
+		CreatedTime: request.CreatedTime,
+	}
+}
+
+type SessionResponse struct {
+	ID           string     `json:"id"`
+	DeviceName   string     `json:"device_name"`
+	UserAgent    string     `json:"user_agent"`
+	IPAddress    string     `json:"ip_address"`
+	CreatedTime  time.Time  `json:"created_time"`
+	LastUsedTime *time.Time `json:"last_used_time"`
+	// Current marks the session of the access token making the request.
+	Current bool `json:"current"`
+}
+
+func convertSessionToResponse(session db.Session, currentSessionID string) SessionResponse {
+	response := SessionResponse{
+		ID:          session.ID,
+		DeviceName:  session.DeviceName,
+		UserAgent:   session.UserAgent,
+		IPAddress:   session.IPAddress,
+		CreatedTime: session.CreatedTime,
+		Current:     session.ID == currentSessionID,
+	}
+	if session.LastUsedTime.Valid {
+		response.LastUsedTime = &session.LastUsedTime.Time
+	}
+	return response
 }
 
 type ContactResponse struct {
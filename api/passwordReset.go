@@ -0,0 +1,121 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mhghw/fara-message/db"
+	"github.com/mhghw/fara-message/mail"
+)
+
+const resetTokenBytes = 32
+
+type forgotPasswordBody struct {
+	Email string `json:"email" validate:"required,email_address"`
+}
+
+type resetPasswordBody struct {
+	Token           string `json:"token" validate:"required"`
+	Password        string `json:"password" validate:"password"`
+	ConfirmPassword string `json:"confirm_password" validate:"eqfield=Password"`
+}
+
+// ForgotPasswordHandler emails a reset token to every account registered
+// with the given address. The accounts are looked up after answering, so
+// neither the answer nor how long it takes tells whether there are any.
+func (s *Server) ForgotPasswordHandler(c *gin.Context) {
+	var body forgotPasswordBody
+	if !s.bindJSON(c, &body) {
+		return
+	}
+	if !s.takeToken(c, "password_reset:email:"+strings.ToLower(body.Email), s.config.RateLimit.PasswordResetEmails) {
+		return
+	}
+
+	go s.sendPasswordResets(body.Email)
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "if an account uses this address, a reset link has been sent to it",
+	})
+}
+
+func (s *Server) sendPasswordResets(email string) {
+	users, err := s.store.ReadUsersByEmail(email)
+	if err != nil {
+		log.Printf("failed to read users for password reset: %v", err)
+		return
+	}
+	for _, user := range users {
+		message, err := s.passwordResetMessage(user)
+		if err != nil {
+			log.Printf("failed to create password reset token for user %s: %v", user.ID, err)
+			continue
+		}
+		s.sendMail(message)
+	}
+}
+
+func (s *Server) passwordResetMessage(user db.UserTable) (mail.Message, error) {
+	raw := make([]byte, resetTokenBytes)
+	if _, err := rand.Read(raw); err != nil {
+		return mail.Message{}, fmt.Errorf("failed to generate token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+	lifetime := s.config.Auth.PasswordResetLifetime.Std()
+	now := time.Now()
+	err := s.store.CreatePasswordResetToken(db.PasswordResetToken{
+		ID:          hashToken(token),
+		UserTableID: user.ID,
+		CreatedTime: now,
+		ExpiresTime: now.Add(lifetime),
+	})
+	if err != nil {
+		return mail.Message{}, err
+	}
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "Hi %s,\n\nsomebody asked to reset the password of your account.\n\n", user.Username)
+	if s.config.Auth.PasswordResetURL != "" {
+		link, err := tokenLink(s.config.Auth.PasswordResetURL, token)
+		if err != nil {
+			return mail.Message{}, err
+		}
+		fmt.Fprintf(&body, "Choose a new password here:\n%s\n\n", link)
+	} else {
+		fmt.Fprintf(&body, "Your reset token is:\n%s\n\n", token)
+	}
+	fmt.Fprintf(&body, "This expires in %d minutes and works once. If it was not you, ignore this email; your password stays as it is.\n", int(lifetime.Minutes()))
+
+	return mail.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body:    body.String(),
+	}, nil
+}
+
+// ResetPasswordHandler sets a new password with a token from the reset
+// email. It logs the account out everywhere.
+func (s *Server) ResetPasswordHandler(c *gin.Context) {
+	var body resetPasswordBody
+	if !s.bindJSON(c, &body) {
+		return
+	}
+	hashedPassword, err := s.passwords.Hash(body.Password)
+	if err != nil {
+		respondError(c, fmt.Errorf("failed to hash password: %w", err))
+		return
+	}
+	userID, err := s.store.ResetPassword(hashToken(body.Token), hashedPassword)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	s.hub.EndUserSessions(userID, "")
+	log.Printf("password of user %s was reset", userID)
+	c.JSON(http.StatusOK, gin.H{"message": "password reset successfully"})
+}
@@ -0,0 +1,99 @@
+package api
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mhghw/fara-message/db"
+)
+
+// ChatPermission is something a user may or may not do in a chat.
+type ChatPermission int
+
+const (
+	PermissionReadMessages ChatPermission = iota
+	PermissionSendMessages
+	PermissionDeleteMessages
+	PermissionListMembers
+	PermissionAddMembers
+	PermissionRemoveMembers
+	PermissionRenameChat
+	PermissionChangeRoles
+	PermissionTransferOwnership
+	PermissionLeaveChat
+	PermissionManageInvites
+)
+
+var (
+	errNotChatMember = errForbidden("you are not a member of this chat")
+	errDirectChat    = errInvalidRequest("direct chats cannot be changed")
+)
+
+// requiredRoles lists the permissions that do not exist in direct chats and
+// the role they take in groups and channels.
+var requiredRoles = map[ChatPermission]db.ChatRole{
+	PermissionAddMembers:        db.RoleAdmin,
+	PermissionRemoveMembers:     db.RoleAdmin,
+	PermissionRenameChat:        db.RoleAdmin,
+	PermissionChangeRoles:       db.RoleOwner,
+	PermissionTransferOwnership: db.RoleOwner,
+	PermissionLeaveChat:         db.RoleMember,
+	PermissionManageInvites:     db.RoleAdmin,
+}
+
+// channelRoles takes precedence over requiredRoles in channels, where only
+// admins post and subscribers do not see each other.
+var channelRoles = map[ChatPermission]db.ChatRole{
+	PermissionSendMessages: db.RoleAdmin,
+	PermissionListMembers:  db.RoleAdmin,
+}
+
+// chatPermission decides whether the member may do what is asked. Every
+// current member may read, write and list the members, except where
+// channelRoles says otherwise; changing a chat takes the role in
+// requiredRoles. Users who have left a chat, or were never in it, may do
+// nothing.
+func chatPermission(member db.ChatMember, permission ChatPermission) error {
+	role, ok := requiredRoles[permission]
+	if ok && int(member.ChatTable.Type) == db.Direct.Int() {
+		return errDirectChat
+	}
+	if isChannel(member.ChatTable) {
+		if channelRole, restricted := channelRoles[permission]; restricted {
+			role, ok = channelRole, true
+		}
+	}
+	if !ok {
+		return nil
+	}
+	if member.Role < role {
+		if role == db.RoleOwner {
+			return errForbidden("only the owner can do this")
+		}
+		return errForbidden("only admins can do this")
+	}
+	return nil
+}
+
+func isChannel(chat db.ChatTable) bool {
+	return int(chat.Type) == db.Channel.Int()
+}
+
+// authorizeChat checks userID's permission in chatID and, when it is missing,
+// writes a 403 and returns false. On success it returns the membership.
+func (s *Server) authorizeChat(c *gin.Context, userID string, chatID string, permission ChatPermission) (db.ChatMember, bool) {
+	member, err := s.store.GetChatMember(chatID, userID)
+	if errors.Is(err, db.ErrNotFound) {
+		respondError(c, errNotChatMember)
+		return member, false
+	}
+	if err != nil {
+		respondError(c, err)
+		return member, false
+	}
+	if err := chatPermission(member, permission); err != nil {
+		respondError(c, err)
+		return member, false
+	}
+	return member, true
+}
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"context"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mhghw/fara-message/db"
+)
+
+// Role is something the caller's account as a whole is allowed, as opposed
+// to the roles members have in a chat.
+type Role string
+
+const (
+	// RoleUser is held by every authenticated caller.
+	RoleUser Role = "user"
+	// RoleVerified is held once the account's email address is verified.
+	RoleVerified Role = "verified"
+)
+
+// Principal is the authenticated caller of a request. AuthMiddlewareHandler
+// puts it into the request context, so handlers never look at the
+// Authorization header themselves.
+type Principal struct {
+	UserID    string
+	SessionID string
+	TokenID   string
+	ExpiresAt time.Time
+	User      db.UserTable
+	Roles     []Role
+}
+
+func (p Principal) HasRole(role Role) bool {
+	for _, r := range p.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// userRoles derives the roles of user's account.
+func userRoles(user db.UserTable) []Role {
+	roles := []Role{RoleUser}
+	if user.EmailVerifiedTime.Valid {
+		roles = append(roles, RoleVerified)
+	}
+	return roles
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns a copy of ctx carrying p.
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFromContext returns the principal stored in ctx by WithPrincipal.
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
+
+func setPrincipal(c *gin.Context, p Principal) {
+	c.Request = c.Request.WithContext(WithPrincipal(c.Request.Context(), p))
+}
+
+// currentPrincipal returns the caller of a route behind AuthMiddlewareHandler.
+// Reaching it on any other route is a programming error, hence the panic
+// instead of an empty user ID.
+func currentPrincipal(c *gin.Context) Principal {
+	p, ok := PrincipalFromContext(c.Request.Context())
+	if !ok || p.UserID == "" {
+		panic("api: no principal in request context, is the route behind AuthMiddlewareHandler?")
+	}
+	return p
+}
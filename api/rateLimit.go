@@ -0,0 +1,67 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mhghw/fara-message/config"
+	"github.com/mhghw/fara-message/throttle"
+)
+
+// rateLimit returns a middleware taking one token per request from the
+// caller's bucket of group. Behind AuthMiddlewareHandler the caller is the
+// user, elsewhere the client IP.
+func (s *Server) rateLimit(group string, cfg config.RateLimitPolicy) gin.HandlerFunc {
+	if !s.config.RateLimit.Enabled || cfg.Requests == 0 {
+		return func(c *gin.Context) { c.Next() }
+	}
+	return func(c *gin.Context) {
+		key := group + ":ip:" + c.ClientIP()
+		if p, ok := PrincipalFromContext(c.Request.Context()); ok {
+			key = group + ":user:" + p.UserID
+		}
+		if !s.takeToken(c, key, cfg) {
+			return
+		}
+		c.Next()
+	}
+}
+
+// takeToken takes a token from the bucket key under cfg. It answers with 429
+// and returns false when the bucket is empty. The RateLimit-* headers follow
+// the IETF RateLimit header fields draft.
+func (s *Server) takeToken(c *gin.Context, key string, cfg config.RateLimitPolicy) bool {
+	if !s.config.RateLimit.Enabled || cfg.Requests == 0 {
+		return true
+	}
+	policy := throttle.BucketPolicy{
+		Rate:  float64(cfg.Requests) / cfg.Per.Std().Seconds(),
+		Burst: cfg.Burst,
+	}
+	take, err := s.buckets.Take(c.Request.Context(), key, time.Now(), policy)
+	if err != nil {
+		// As with the login throttle, a broken store must not take the
+		// whole API down.
+		log.Printf("failed to take rate limit token: %v", err)
+		return true
+	}
+	c.Header("RateLimit-Policy", fmt.Sprintf("%d;w=%d", policy.Burst, ceilSeconds(policy.Window())))
+	c.Header("RateLimit-Limit", strconv.Itoa(take.Limit))
+	c.Header("RateLimit-Remaining", strconv.Itoa(take.Remaining))
+	c.Header("RateLimit-Reset", strconv.Itoa(ceilSeconds(take.Reset)))
+	if !take.Allowed {
+		c.Header("Retry-After", strconv.Itoa(ceilSeconds(take.RetryAfter)))
+		respondError(c, newAPIError(http.StatusTooManyRequests, CodeRateLimited, "rate limit exceeded, try again later"))
+		return false
+	}
+	return true
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
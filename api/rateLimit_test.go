@@ -0,0 +1,60 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/mhghw/fara-message/config"
+)
+
+func TestRateLimitHeaders(t *testing.T) {
+	s, _ := newTestServer(t, func(cfg *config.Config) {
+		cfg.RateLimit.Enabled = true
+		cfg.RateLimit.Public = config.RateLimitPolicy{Requests: 60, Per: config.Duration(time.Minute), Burst: 2}
+	})
+
+	// One token a second with room for two: the third request in a row is
+	// turned away.
+	tests := []struct {
+		wantStatus     int
+		wantRemaining  string
+		wantReset      string
+		wantRetryAfter string
+	}{
+		{wantStatus: http.StatusOK, wantRemaining: "1", wantReset: "1"},
+		{wantStatus: http.StatusOK, wantRemaining: "0", wantReset: "2"},
+		{wantStatus: http.StatusTooManyRequests, wantRemaining: "0", wantReset: "2", wantRetryAfter: "1"},
+	}
+	for i, tt := range tests {
+		recorder := do(t, s, http.MethodGet, "/.well-known/jwks.json", "", nil)
+		if recorder.Code != tt.wantStatus {
+			t.Fatalf("request %d: got %d, want %d", i+1, recorder.Code, tt.wantStatus)
+		}
+		want := map[string]string{
+			"RateLimit-Policy":    "2;w=2",
+			"RateLimit-Limit":     "2",
+			"RateLimit-Remaining": tt.wantRemaining,
+			"RateLimit-Reset":     tt.wantReset,
+			"Retry-After":         tt.wantRetryAfter,
+		}
+		for header, value := range want {
+			if got := recorder.Header().Get(header); got != value {
+				t.Errorf("request %d: %s = %q, want %q", i+1, header, got, value)
+			}
+		}
+		if tt.wantStatus == http.StatusTooManyRequests {
+			if got := decode[ErrorResponse](t, recorder).Code; got != CodeRateLimited {
+				t.Errorf("code = %q, want %q", got, CodeRateLimited)
+			}
+		}
+	}
+}
+
+func TestRateLimitDisabled(t *testing.T) {
+	s, _ := newTestServer(t)
+	recorder := do(t, s, http.MethodGet, "/.well-known/jwks.json", "", nil)
+	if got := recorder.Header().Get("RateLimit-Limit"); got != "" {
+		t.Errorf("RateLimit-Limit = %q, want none", got)
+	}
+}
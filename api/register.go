@@ -2,7 +2,6 @@ package api
 
 import (
 	"errors"
-	"fmt"
 	"log"
 	"net/http"
 	"regexp"
@@ -11,100 +10,55 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/mhghw/fara-message/db"
-	"gorm.io/gorm"
 )
 
 type RegisterForm struct {
-	Username        string `json:"username"`
-	FirstName       string `json:"first_name"`
-	LastName        string `json:"last_name"`
-	Password        string `json:"password"`
-	ConfirmPassword string `json:"confirm_password"`
-	Gender          string `json:"gender"`
-	DateOfBirth     string `json:"date_of_birth"`
-	Email           string `json:"email"`
+	Username        string `json:"username" validate:"username"`
+	FirstName       string `json:"first_name" validate:"name"`
+	LastName        string `json:"last_name" validate:"name"`
+	Password        string `json:"password" validate:"password"`
+	ConfirmPassword string `json:"confirm_password" validate:"eqfield=Password"`
+	Gender          string `json:"gender" validate:"required,gender"`
+	DateOfBirth     string `json:"date_of_birth" validate:"required,date_of_birth"`
+	Email           string `json:"email" validate:"required,email_address"`
+	DeviceName      string `json:"device_name"`
 }
 
-type tokenJSON struct {
-	Token string `json:"token"`
-}
-
-func RegisterHandler(c *gin.Context) {
+func (s *Server) RegisterHandler(c *gin.Context) {
 	var requestBody RegisterForm
-	err := c.BindJSON(&requestBody)
-	if err != nil {
-		log.Print("failed to bind json", err)
-		return
-	}
-	err = validateUser(requestBody)
-	if err != nil {
-		c.JSON(400, gin.H{
-			"error": fmt.Sprintf("failed to validate: %v", err),
-		})
+	if !s.bindJSON(c, &requestBody) {
 		return
 	}
 
-	user, err := convertRegisterFormToUser(requestBody)
+	user, err := convertRegisterFormToUser(requestBody, s.passwords)
 	if err != nil {
-		log.Print("failed to convert register form to user")
+		respondError(c, err)
 		return
 	}
-	repeatedUserName, err := CheckRepeatedUser(user.Username)
+	repeatedUserName, err := s.CheckRepeatedUser(user.Username)
 	if err != nil {
-		log.Printf("failed to check for repeated user: %v", err)
+		respondError(c, err)
 		return
 	}
 	if repeatedUserName {
-		log.Printf("repeated userName")
-		c.JSON(400, "repeated username")
+		respondError(c, errConflict("username is already taken"))
 		return
 	}
-	token, err := CreateJWTToken(user.ID.String())
-	if err != nil {
-		log.Print("failed to create token")
+	if err := s.store.CreateUser(user); err != nil {
+		respondError(c, err)
 		return
 	}
-	userToken := tokenJSON{
-		Token: token,
-	}
-
-	db.Mysql.CreateUser(user)
-	c.JSON(http.StatusOK, userToken.Token)
-}
-
-func validateUser(form RegisterForm) error {
-	if len(form.Username) < 4 || form.Username == "" {
-		return errors.New("username length must be more than 5 characters")
-	}
-	if len(form.FirstName) < 3 || form.FirstName == "" {
-		return errors.New("first name length must be more than 3 characters")
-	}
-	if len(form.LastName) < 3 || form.LastName == "" {
-		return errors.New("last name length must be more than 3 characters")
-	}
-	if form.Gender == "" {
-		return errors.New("please fill the gender section")
+	if err := s.sendVerificationEmail(db.ConvertUserToUserTable(user)); err != nil {
+		log.Printf("failed to send verification email: %v", err)
 	}
-
-	if strings.ToLower(form.Gender) != "male" && strings.ToLower(form.Gender) != "female" && strings.ToLower(form.Gender) != "non binary" {
-		return errors.New("wrong gender type ")
-	}
-	if form.DateOfBirth == "" {
-		return errors.New("please fill the date of birth section")
-	}
-
-	if len(form.Password) < 8 {
-		return errors.New("password is too short")
-	}
-	if form.Password != form.ConfirmPassword {
-		return errors.New("password does not match")
-	}
-	if !IsValidEmail(form.Email) {
-		return errors.New("please insert a valid email address")
+	tokens, err := s.issueTokens(c, user.ID.String(), requestBody.DeviceName)
+	if err != nil {
+		respondError(c, err)
+		return
 	}
-
-	return nil
+	c.JSON(http.StatusOK, tokens)
 }
+
 func assignGender(sex string) db.Gender {
 	var gender db.Gender
 	switch strings.ToLower(sex) {
@@ -118,16 +72,25 @@ func assignGender(sex string) db.Gender {
 	return gender
 
 }
-func convertRegisterFormToUser(form RegisterForm) (db.User, error) {
+
+// convertRegisterFormToUser hashes the password with passwords. An empty
+// password stays empty so that updates leave the stored one alone.
+func convertRegisterFormToUser(form RegisterForm, passwords *PasswordHasher) (db.User, error) {
 	// time.DateOnly
 	convertTime, err := time.Parse(time.DateOnly, form.DateOfBirth)
 	if err != nil {
-		return db.User{}, fmt.Errorf("failed to parse date %w", err)
+		return db.User{}, errValidation("date_of_birth must be a date like 2006-01-02")
 	}
 
 	gender := assignGender(form.Gender)
 	generatedID := generateID()
-	password := hash(form.Password)
+	var password string
+	if form.Password != "" {
+		password, err = passwords.Hash(form.Password)
+		if err != nil {
+			return db.User{}, err
+		}
+	}
 	user := db.User{
 		ID:          generatedID,
 		Username:    form.Username,
@@ -144,13 +107,13 @@ func convertRegisterFormToUser(form RegisterForm) (db.User, error) {
 	return user, nil
 }
 
-func CheckRepeatedUser(username string) (bool, error) {
+func (s *Server) CheckRepeatedUser(username string) (bool, error) {
 	result := true
 	var err error
 	err = nil
-	_, err = db.Mysql.ReadUserByUsername(username)
+	_, err = s.store.ReadUserByUsername(username)
 	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
+		if errors.Is(err, db.ErrNotFound) {
 			result = false
 			err = nil
 			return result, err
@@ -1,32 +1,226 @@
 package api
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log"
+	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/mhghw/fara-message/config"
+	"github.com/mhghw/fara-message/db"
+	"github.com/mhghw/fara-message/mail"
+	"github.com/mhghw/fara-message/realtime"
+	"github.com/mhghw/fara-message/throttle"
 )
 
-func RunWebServer(port int) error {
-	addr := fmt.Sprintf(":%d", port)
+// Server holds the dependencies shared by the HTTP handlers. Every handler is
+// a method on Server so several instances, each with its own store, can live
+// in one process.
+type Server struct {
+	config    config.Config
+	store     db.Store
+	keys      *Keyring
+	tokens    *JWTManager
+	passwords *PasswordHasher
+	validator *requestValidator
+	hub       *realtime.Hub
+	mailer    mail.Mailer
+	router    *gin.Engine
+
+	loginLimiter *throttle.LoginLimiter
+	buckets      throttle.BucketStore
+	// dummyPasswordHash is verified against for unknown usernames.
+	dummyPasswordHash string
+}
+
+func NewServer(cfg config.Config, store db.Store) (*Server, error) {
+	keys, err := NewKeyring(cfg.Auth.Signing, cfg.Auth.JWTSecret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load signing keys: %w", err)
+	}
+	mailer, err := mail.New(cfg.Mail)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set up mail: %w", err)
+	}
+	s := &Server{
+		config: cfg,
+		store:  store,
+		keys:   keys,
+		tokens: NewJWTManager(keys, cfg.Auth),
+		passwords: NewPasswordHasher(Argon2Params{
+			Memory:      uint32(cfg.Auth.PasswordHash.MemoryKiB),
+			Iterations:  uint32(cfg.Auth.PasswordHash.Iterations),
+			Parallelism: uint8(cfg.Auth.PasswordHash.Parallelism),
+		}),
+		hub:          realtime.NewHub(cfg.Realtime.SendBuffer, cfg.Realtime.HistorySize),
+		mailer:       mailer,
+		loginLimiter: newLoginLimiter(cfg.Auth.LoginThrottle),
+		buckets:      throttle.NewMemoryBuckets(),
+	}
+	s.validator, err = newRequestValidator(cfg.Users)
+	if err != nil {
+		return nil, err
+	}
+	s.dummyPasswordHash, err = s.passwords.Hash(generateID().String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash dummy password: %w", err)
+	}
 	router := gin.New()
-	router.POST("/register", RegisterHandler)
-	router.POST("/login", loginHandler)
-	router.Use(AuthMiddlewareHandler)
-	router.POST("/user/info", ReadUserHandler)
-	router.POST("user/change_password", changePassword)
-	router.POST("/user/update", UpdateUserHandler)
-	router.DELETE("/user/delete", DeleteUserHandler)
-	router.POST("/user/edit", editUser)
-	router.POST("/user/contact/:id", addContactHandler)
-	router.DELETE("/user/contact/:id", DeleteContactHandler)
-	router.GET("/user/contact", GetUserContactsHandler)
-
-	router.POST("/send/message", SendMessageHandler)
-	router.DELETE("/delete/message", DeleteMessageHandler)
-	router.POST("/chat/direct", NewDirectChatHandler)
-	router.POST("/chat/group", NewGroupChatHandler)
-	router.GET("/chat/:id", GetChatMessagesHandler)
-	router.GET("/user/chat/list", GetUsersChatsHandler)
-	err := router.Run(addr)
-	return err
+	router.Use(gin.CustomRecovery(recoverPanic))
+	router.NoRoute(func(c *gin.Context) {
+		respondError(c, errNotFound("no such endpoint"))
+	})
+	if err := router.SetTrustedProxies(trustedProxies(cfg.Server.TrustedProxies)); err != nil {
+		return nil, fmt.Errorf("invalid server.trusted_proxies: %w", err)
+	}
+	router.Use(s.limitBodySize)
+	rateLimits := cfg.RateLimit
+
+	public := router.Group("/", s.rateLimit("public", rateLimits.Public))
+	public.POST("/register", s.RegisterHandler)
+	public.POST("/login", s.loginHandler)
+	public.POST("/login/2fa", s.TwoFactorLoginHandler)
+	public.POST("/token/refresh", s.RefreshTokenHandler)
+	public.POST("/password/forgot", s.ForgotPasswordHandler)
+	public.POST("/password/reset", s.ResetPasswordHandler)
+	public.POST("/email/verify", s.VerifyEmailHandler)
+	public.GET("/.well-known/jwks.json", s.JWKSHandler)
+	public.GET("/ws", s.WebSocketHandler)
+	public.GET("/events", s.EventStreamHandler)
+
+	authenticated := router.Group("/", s.AuthMiddlewareHandler)
+
+	user := authenticated.Group("/", s.rateLimit("default", rateLimits.Default))
+	user.POST("/logout", s.LogoutHandler)
+	user.POST("/stream/ticket", s.StreamTicketHandler)
+	user.POST("/user/info", s.ReadUserHandler)
+	user.POST("user/change_password", s.changePassword)
+	user.POST("/user/update", s.UpdateUserHandler)
+	user.DELETE("/user/delete", s.DeleteUserHandler)
+	user.POST("/user/edit", s.editUser)
+	user.POST("/user/contact/:id", s.RequireVerifiedEmail, s.addContactHandler)
+	user.DELETE("/user/contact/:id", s.DeleteContactHandler)
+	user.GET("/user/contact", s.GetUserContactsHandler)
+	user.GET("/chat/:id", s.GetChatMessagesHandler)
+	user.GET("/chat/:id/members", s.GetChatMembersHandler)
+	user.POST("/chat/:id/members", s.RequireVerifiedEmail, s.AddChatMemberHandler)
+	user.DELETE("/chat/:id/members/:user_id", s.RemoveChatMemberHandler)
+	user.PUT("/chat/:id/members/:user_id/role", s.ChangeChatMemberRoleHandler)
+	user.PATCH("/chat/:id", s.RenameChatHandler)
+	user.POST("/chat/:id/owner", s.TransferChatOwnershipHandler)
+	user.POST("/chat/:id/leave", s.LeaveChatHandler)
+	user.POST("/chat/:id/invites", s.CreateChatInviteHandler)
+	user.GET("/chat/:id/invites", s.GetChatInvitesHandler)
+	user.DELETE("/chat/:id/invites/:invite_id", s.RevokeChatInviteHandler)
+	user.GET("/chat/:id/join_requests", s.GetChatJoinRequestsHandler)
+	user.POST("/chat/:id/join_requests/:user_id", s.ApproveChatJoinRequestHandler)
+	user.DELETE("/chat/:id/join_requests/:user_id", s.RejectChatJoinRequestHandler)
+	user.GET("/channels", s.SearchChannelsHandler)
+	user.GET("/channels/:handle", s.GetChannelHandler)
+	user.POST("/chat/:id/subscribe", s.SubscribeChannelHandler)
+	user.DELETE("/chat/:id/subscribe", s.UnsubscribeChannelHandler)
+	user.GET("/message/:id/revisions", s.GetMessageRevisionsHandler)
+	user.GET("/user/chat/list", s.GetUsersChatsHandler)
+	user.GET("/user/sessions", s.GetSessionsHandler)
+	user.DELETE("/user/sessions", s.RevokeOtherSessionsHandler)
+	user.DELETE("/user/sessions/:id", s.RevokeSessionHandler)
+	user.POST("/user/2fa/enroll", s.EnrollTwoFactorHandler)
+	user.POST("/user/2fa/confirm", s.ConfirmTwoFactorHandler)
+	user.DELETE("/user/2fa", s.DisableTwoFactorHandler)
+	user.POST("/user/email", s.ChangeEmailHandler)
+	user.POST("/user/email/resend", s.ResendVerificationHandler)
+
+	messages := authenticated.Group("/", s.rateLimit("messages", rateLimits.Messages))
+	messages.POST("/send/message", s.SendMessageHandler)
+	messages.DELETE("/delete/message", s.DeleteMessageHandler)
+	messages.PATCH("/message/:id", s.EditMessageHandler)
+
+	chats := authenticated.Group("/", s.rateLimit("chats", rateLimits.Chats))
+	chats.POST("/chat/direct", s.NewDirectChatHandler)
+	chats.POST("/chat/group", s.RequireVerifiedEmail, s.NewGroupChatHandler)
+	chats.POST("/chat/channel", s.RequireVerifiedEmail, s.NewChannelHandler)
+	chats.POST("/chat/join/:token", s.RequireVerifiedEmail, s.JoinChatHandler)
+	s.router = router
+	return s, nil
+}
+
+// Handler exposes the router so the server can be mounted or driven directly,
+// e.g. with httptest.
+func (s *Server) Handler() *gin.Engine {
+	return s.router
+}
+
+// Run serves HTTP until ctx is cancelled and then shuts down gracefully,
+// giving in-flight requests up to server.shutdown_timeout to finish.
+func (s *Server) Run(ctx context.Context) error {
+	httpServer := &http.Server{
+		Addr:              fmt.Sprintf(":%d", s.config.Server.Port),
+		Handler:           s.router,
+		ReadTimeout:       s.config.Server.ReadTimeout.Std(),
+		ReadHeaderTimeout: s.config.Server.ReadHeaderTimeout.Std(),
+		WriteTimeout:      s.config.Server.WriteTimeout.Std(),
+		IdleTimeout:       s.config.Server.IdleTimeout.Std(),
+		MaxHeaderBytes:    s.config.Server.MaxHeaderBytes,
+	}
+
+	keysCtx, stopKeys := context.WithCancel(ctx)
+	defer stopKeys()
+	go s.keys.run(keysCtx)
+
+	errCh := make(chan error, 1)
+	go func() {
+		log.Printf("listening on %s", httpServer.Addr)
+		errCh <- httpServer.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+
+	// Shutdown does not touch hijacked connections and waits for streaming
+	// responses, so end the WebSocket and event stream sessions first.
+	s.hub.Close()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.config.Server.ShutdownTimeout.Std())
+	defer cancel()
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("failed to shut down HTTP server: %w", err)
+	}
+	if err := <-errCh; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func RunWebServer(cfg config.Config, store db.Store) error {
+	s, err := NewServer(cfg, store)
+	if err != nil {
+		return err
+	}
+	return s.Run(context.Background())
+}
+
+// trustedProxies splits server.trusted_proxies. No proxies means ClientIP is
+// the remote address and X-Forwarded-For is ignored.
+func trustedProxies(list string) []string {
+	var proxies []string
+	for _, proxy := range strings.Split(list, ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	return proxies
+}
+
+// limitBodySize caps request bodies at server.max_body_bytes.
+func (s *Server) limitBodySize(c *gin.Context) {
+	if s.config.Server.MaxBodyBytes > 0 {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, s.config.Server.MaxBodyBytes)
+	}
+	c.Next()
 }
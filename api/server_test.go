@@ -0,0 +1,125 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mhghw/fara-message/config"
+	"github.com/mhghw/fara-message/db"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// newTestServer returns a server backed by a fresh, migrated SQLite database
+// in memory. Rate limits are off and password hashing is cheap unless
+// configure says otherwise.
+func newTestServer(t *testing.T, configure ...func(*config.Config)) (*Server, *db.Database) {
+	t.Helper()
+	cfg := config.Default()
+	cfg.Database.Driver = config.DriverSQLite
+	cfg.Database.DSN = ":memory:"
+	cfg.Auth.PasswordHash = config.PasswordHash{MemoryKiB: 8, Iterations: 1, Parallelism: 1}
+	cfg.RateLimit.Enabled = false
+	for _, f := range configure {
+		f(&cfg)
+	}
+	store, err := db.NewDatabase(db.Config{Driver: cfg.Database.Driver, DSN: cfg.Database.DSN})
+	if err != nil {
+		t.Fatalf("NewDatabase: %v", err)
+	}
+	if _, err := store.MigrateUp(); err != nil {
+		t.Fatalf("MigrateUp: %v", err)
+	}
+	s, err := NewServer(cfg, store)
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	return s, store
+}
+
+// do sends a request with body encoded as JSON, and token as bearer token
+// unless it is empty.
+func do(t *testing.T, s *Server, method string, path string, token string, body any) *httptest.ResponseRecorder {
+	t.Helper()
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("failed to encode body: %v", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	request := httptest.NewRequest(method, path, reader)
+	request.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	recorder := httptest.NewRecorder()
+	s.Handler().ServeHTTP(recorder, request)
+	return recorder
+}
+
+func decode[T any](t *testing.T, recorder *httptest.ResponseRecorder) T {
+	t.Helper()
+	var value T
+	if err := json.Unmarshal(recorder.Body.Bytes(), &value); err != nil {
+		t.Fatalf("failed to decode %q: %v", recorder.Body.String(), err)
+	}
+	return value
+}
+
+// register signs up username through the API and returns its tokens.
+func register(t *testing.T, s *Server, username string) TokenResponse {
+	t.Helper()
+	recorder := do(t, s, http.MethodPost, "/register", "", RegisterForm{
+		Username:        username,
+		FirstName:       "First",
+		LastName:        "Last",
+		Password:        "password1",
+		ConfirmPassword: "password1",
+		Gender:          "female",
+		DateOfBirth:     "1990-01-01",
+		Email:           username + "@example.com",
+	})
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("register %s: %d %s", username, recorder.Code, recorder.Body.String())
+	}
+	return decode[TokenResponse](t, recorder)
+}
+
+func TestRegisterAndLogin(t *testing.T) {
+	s, store := newTestServer(t)
+	register(t, s, "alice")
+
+	recorder := do(t, s, http.MethodPost, "/login", "", loginBody{Username: "alice", Password: "password1"})
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("login: %d %s", recorder.Code, recorder.Body.String())
+	}
+	tokens := decode[TokenResponse](t, recorder)
+	recorder = do(t, s, http.MethodPost, "/user/info", tokens.AccessToken, nil)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("user info: %d %s", recorder.Code, recorder.Body.String())
+	}
+	if got := decode[RegisterForm](t, recorder).Username; got != "alice" {
+		t.Errorf("user info is of %q, want alice", got)
+	}
+
+	user, err := store.ReadUserByUsername("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Password == "password1" || user.Password == "" {
+		t.Errorf("stored password is %q, want a hash", user.Password)
+	}
+}
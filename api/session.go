@@ -0,0 +1,51 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SessionsResponse struct {
+	Sessions []SessionResponse `json:"sessions"`
+}
+
+// GetSessionsHandler lists the devices the user is logged in on.
+func (s *Server) GetSessionsHandler(c *gin.Context) {
+	principal := currentPrincipal(c)
+	sessions, err := s.store.GetUserSessions(principal.UserID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	response := SessionsResponse{Sessions: make([]SessionResponse, 0, len(sessions))}
+	for _, session := range sessions {
+		response.Sessions = append(response.Sessions, convertSessionToResponse(session, principal.SessionID))
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// RevokeSessionHandler logs one of the user's devices out. Revoking the
+// current session is the same as logging out.
+func (s *Server) RevokeSessionHandler(c *gin.Context) {
+	principal := currentPrincipal(c)
+	if err := s.store.RevokeUserSession(principal.UserID, c.Param("id")); err != nil {
+		respondError(c, err)
+		return
+	}
+	s.hub.EndSession(c.Param("id"))
+	c.Status(http.StatusNoContent)
+}
+
+// RevokeOtherSessionsHandler logs out every device of the user except the
+// one making the request.
+func (s *Server) RevokeOtherSessionsHandler(c *gin.Context) {
+	principal := currentPrincipal(c)
+	revoked, err := s.store.RevokeOtherSessions(principal.UserID, principal.SessionID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	s.hub.EndUserSessions(principal.UserID, principal.SessionID)
+	c.JSON(http.StatusOK, gin.H{"revoked": revoked})
+}
@@ -0,0 +1,157 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+	"github.com/mhghw/fara-message/db"
+	"github.com/mhghw/fara-message/realtime"
+)
+
+// EventResync tells an SSE client that events were missed while it was away
+// and it has to reload its chats instead of relying on the stream.
+const EventResync = "resync"
+
+// EventStreamHandler serves the user's events as server-sent events, for
+// clients that cannot hold a WebSocket open. Reconnecting clients send the
+// Last-Event-ID header (or last_event_id query parameter) and get everything
+// they missed that is still in the hub's history.
+func (s *Server) EventStreamHandler(c *gin.Context) {
+	principal, ok := s.authenticateStream(c)
+	if !ok {
+		return
+	}
+
+	var lastEventID uint64
+	lastEventIDString := c.GetHeader("Last-Event-ID")
+	if lastEventIDString == "" {
+		lastEventIDString = c.Query("last_event_id")
+	}
+	if lastEventIDString != "" {
+		var err error
+		lastEventID, err = strconv.ParseUint(lastEventIDString, 10, 64)
+		if err != nil {
+			respondError(c, errInvalidRequest("invalid Last-Event-ID"))
+			return
+		}
+	}
+
+	// The stream outlives the server's write timeout by design.
+	if err := http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{}); err != nil {
+		log.Printf("failed to clear write deadline: %v", err)
+	}
+
+	sub, replay, complete := s.hub.SubscribeFrom(principal.UserID, principal.SessionID, lastEventID)
+	defer s.hub.Unsubscribe(sub)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	// Stop nginx and friends from buffering the stream.
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	if !complete {
+		writeEvent(c, sse.Event{Event: EventResync, Data: "{}"})
+	}
+	for _, event := range replay {
+		writeEvent(c, toSSE(event))
+	}
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(s.config.Realtime.PingInterval.Std())
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case event, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			if err := writeEvent(c, toSSE(event)); err != nil {
+				return
+			}
+			c.Writer.Flush()
+		case <-heartbeat.C:
+			if _, err := c.Writer.WriteString(": ping\n\n"); err != nil {
+				return
+			}
+			c.Writer.Flush()
+		}
+	}
+}
+
+func toSSE(event realtime.Event) sse.Event {
+	return sse.Event{
+		Id:    strconv.FormatUint(event.ID, 10),
+		Event: event.Type,
+		Data:  event,
+	}
+}
+
+func writeEvent(c *gin.Context, event sse.Event) error {
+	return sse.Encode(c.Writer, event)
+}
+
+type StreamTicketResponse struct {
+	Ticket    string    `json:"ticket"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// StreamTicketHandler hands out a ticket for opening /ws or /events.
+// Browsers' WebSocket and EventSource APIs cannot set headers, so they pass
+// the ticket as the ticket query parameter instead of putting the access
+// token into the URL. A ticket is short-lived and opens one stream.
+func (s *Server) StreamTicketHandler(c *gin.Context) {
+	principal := currentPrincipal(c)
+	ticket, expiresAt, err := s.tokens.CreateStreamTicket(principal.UserID, principal.SessionID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, StreamTicketResponse{Ticket: ticket, ExpiresAt: expiresAt})
+}
+
+// authenticateStream authenticates a streaming request by its Authorization
+// header or, failing that, by a stream ticket, which it uses up. The stream
+// belongs to the session of the token or ticket and is closed when that
+// session ends.
+func (s *Server) authenticateStream(c *gin.Context) (Principal, bool) {
+	principal, err := s.streamPrincipal(c)
+	if err != nil {
+		respondError(c, err)
+		return Principal{}, false
+	}
+	setPrincipal(c, principal)
+	return principal, true
+}
+
+func (s *Server) streamPrincipal(c *gin.Context) (Principal, error) {
+	if tokenString := c.GetHeader("Authorization"); tokenString != "" {
+		return s.authenticate(c, tokenString)
+	}
+	ticket := c.Query("ticket")
+	if ticket == "" {
+		return Principal{}, errUnauthorized("an access token or stream ticket is required")
+	}
+	claims, err := s.tokens.ParseStreamTicket(ticket)
+	if err != nil {
+		log.Printf("failed to validate stream ticket: %v", err)
+		return Principal{}, errUnauthorized("invalid or expired ticket")
+	}
+	// The ticket is used up by revoking it. Only one request can do so, so
+	// there is no need to check whether it was used before.
+	if err := s.store.RevokeAccessToken(claims.TokenID, claims.ExpiresAt); err != nil {
+		if errors.Is(err, db.ErrConflict) {
+			return Principal{}, errUnauthorized("invalid or expired ticket")
+		}
+		return Principal{}, err
+	}
+	return s.authenticateSession(c, claims)
+}
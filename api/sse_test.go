@@ -0,0 +1,39 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestStreamTicketWorksOnce(t *testing.T) {
+	s, _ := newTestServer(t)
+	alice := register(t, s, "alice")
+	recorder := do(t, s, http.MethodPost, "/stream/ticket", alice.AccessToken, nil)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("stream ticket: %d %s", recorder.Code, recorder.Body.String())
+	}
+	ticket := decode[StreamTicketResponse](t, recorder).Ticket
+
+	var opened atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodGet, "/events?ticket="+ticket, nil)
+			if _, err := s.streamPrincipal(c); err == nil {
+				opened.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := opened.Load(); n != 1 {
+		t.Errorf("the ticket opened %d streams, want 1", n)
+	}
+}
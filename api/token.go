@@ -0,0 +1,247 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mhghw/fara-message/db"
+)
+
+// A login opens a session and hands out a short-lived access token together
+// with a refresh token. Each refresh uses up the refresh token and returns a
+// new pair for the same session. If a used refresh token turns up again, two
+// parties hold the same session, so the whole session is revoked.
+
+const (
+	refreshTokenBytes = 32
+	// sessionTouchInterval limits how often a request updates the session's
+	// last-used time, so that not every request turns into a write.
+	sessionTouchInterval = time.Minute
+	maxDeviceNameLength  = 255
+	maxUserAgentLength   = 512
+)
+
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+type refreshBody struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+var (
+	errInvalidAccessToken = errUnauthorized("invalid or expired access token")
+	errSessionRevoked     = errUnauthorized("session has been revoked")
+	errInvalidRefresh     = errUnauthorized("invalid refresh token")
+)
+
+// issueTokens opens a new session for userID on the device making request c.
+// deviceName is whatever the client calls itself, e.g. "Pixel 8".
+func (s *Server) issueTokens(c *gin.Context, userID string, deviceName string) (TokenResponse, error) {
+	refreshToken, row, err := s.newRefreshToken(generateID().String())
+	if err != nil {
+		return TokenResponse{}, err
+	}
+	session := db.Session{
+		ID:           row.SessionID,
+		UserTableID:  userID,
+		DeviceName:   truncate(deviceName, maxDeviceNameLength),
+		UserAgent:    truncate(c.Request.UserAgent(), maxUserAgentLength),
+		IPAddress:    c.ClientIP(),
+		CreatedTime:  row.CreatedTime,
+		LastUsedTime: sql.NullTime{Time: row.CreatedTime, Valid: true},
+	}
+	if err := s.store.CreateSession(session, row); err != nil {
+		return TokenResponse{}, err
+	}
+	return s.tokenResponse(userID, session.ID, refreshToken)
+}
+
+func (s *Server) newRefreshToken(sessionID string) (string, db.RefreshToken, error) {
+	raw := make([]byte, refreshTokenBytes)
+	if _, err := rand.Read(raw); err != nil {
+		return "", db.RefreshToken{}, fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+	now := time.Now()
+	return token, db.RefreshToken{
+		ID:          hashToken(token),
+		SessionID:   sessionID,
+		CreatedTime: now,
+		ExpiresTime: now.Add(s.config.Auth.RefreshTokenLifetime.Std()),
+	}, nil
+}
+
+func (s *Server) tokenResponse(userID string, sessionID string, refreshToken string) (TokenResponse, error) {
+	accessToken, err := s.tokens.CreateJWTToken(userID, sessionID)
+	if err != nil {
+		return TokenResponse{}, err
+	}
+	return TokenResponse{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(s.config.Auth.AccessTokenLifetime.Std().Seconds()),
+	}, nil
+}
+
+// hashToken is how refresh tokens and other one-time secrets are stored, so
+// that a database leak does not hand them out.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func truncate(value string, length int) string {
+	if len(value) <= length {
+		return value
+	}
+	return value[:length]
+}
+
+// authenticate parses the access token of request c, makes sure neither the
+// token nor its session has been revoked and loads the user it belongs to.
+// A token that is no good gives a 401 APIError, any other error is ours.
+func (s *Server) authenticate(c *gin.Context, tokenString string) (Principal, error) {
+	if tokenString == "" {
+		return Principal{}, errUnauthorized("an access token is required")
+	}
+	claims, err := s.tokens.ParseToken(tokenString)
+	if err != nil {
+		log.Printf("failed to validate token: %v", err)
+		return Principal{}, errInvalidAccessToken
+	}
+	revoked, err := s.store.IsAccessTokenRevoked(claims.TokenID)
+	if err != nil {
+		return Principal{}, err
+	}
+	if revoked {
+		return Principal{}, errInvalidAccessToken
+	}
+	return s.authenticateSession(c, claims)
+}
+
+// authenticateSession checks that the session and user a token was issued
+// for are still there.
+func (s *Server) authenticateSession(c *gin.Context, claims AccessClaims) (Principal, error) {
+	session, err := s.store.GetSession(claims.SessionID)
+	if errors.Is(err, db.ErrNotFound) {
+		return Principal{}, errInvalidAccessToken
+	}
+	if err != nil {
+		return Principal{}, err
+	}
+	if session.RevokedTime.Valid || session.UserTableID != claims.UserID {
+		return Principal{}, errSessionRevoked
+	}
+	user, err := s.store.ReadUser(claims.UserID)
+	if errors.Is(err, db.ErrNotFound) {
+		return Principal{}, errInvalidAccessToken
+	}
+	if err != nil {
+		return Principal{}, fmt.Errorf("failed to read user of token: %w", err)
+	}
+	if !session.LastUsedTime.Valid || time.Since(session.LastUsedTime.Time) > sessionTouchInterval {
+		if err := s.store.TouchSession(session.ID, c.ClientIP()); err != nil {
+			log.Printf("failed to touch session: %v", err)
+		}
+	}
+	return Principal{
+		UserID:    claims.UserID,
+		SessionID: claims.SessionID,
+		TokenID:   claims.TokenID,
+		ExpiresAt: claims.ExpiresAt,
+		User:      user,
+		Roles:     userRoles(user),
+	}, nil
+}
+
+func (s *Server) RefreshTokenHandler(c *gin.Context) {
+	var body refreshBody
+	if !s.bindJSON(c, &body) {
+		return
+	}
+	used, err := s.store.UseRefreshToken(hashToken(body.RefreshToken))
+	if errors.Is(err, db.ErrRefreshTokenReused) {
+		log.Printf("refresh token of session %s was reused, revoking the session", used.SessionID)
+		if err := s.store.RevokeSession(used.SessionID); err != nil {
+			log.Printf("failed to revoke session: %v", err)
+		}
+		s.hub.EndSession(used.SessionID)
+		respondError(c, errInvalidRefresh)
+		return
+	}
+	if errors.Is(err, db.ErrNotFound) {
+		respondError(c, errInvalidRefresh)
+		return
+	}
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if used.ExpiresTime.Before(time.Now()) {
+		respondError(c, errUnauthorized("refresh token has expired"))
+		return
+	}
+	session, err := s.store.GetSession(used.SessionID)
+	if errors.Is(err, db.ErrNotFound) {
+		respondError(c, errInvalidRefresh)
+		return
+	}
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if session.RevokedTime.Valid {
+		respondError(c, errSessionRevoked)
+		return
+	}
+
+	refreshToken, row, err := s.newRefreshToken(session.ID)
+	if err != nil {
+		respondError(c, fmt.Errorf("failed to create refresh token: %w", err))
+		return
+	}
+	if err := s.store.CreateRefreshToken(row); err != nil {
+		respondError(c, err)
+		return
+	}
+	if err := s.store.TouchSession(session.ID, c.ClientIP()); err != nil {
+		log.Printf("failed to touch session: %v", err)
+	}
+	response, err := s.tokenResponse(session.UserTableID, session.ID, refreshToken)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// LogoutHandler ends the session of the calling access token. Other sessions
+// of the same user stay logged in.
+func (s *Server) LogoutHandler(c *gin.Context) {
+	principal := currentPrincipal(c)
+	if err := s.store.RevokeSession(principal.SessionID); err != nil {
+		respondError(c, err)
+		return
+	}
+	s.hub.EndSession(principal.SessionID)
+	// A concurrent logout with the same token may have revoked it already.
+	if err := s.store.RevokeAccessToken(principal.TokenID, principal.ExpiresAt); err != nil && !errors.Is(err, db.ErrConflict) {
+		respondError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestRefreshToken(t *testing.T) {
+	tests := []struct {
+		name string
+		// refresh picks what to send, given the tokens from registering
+		// and from one successful refresh.
+		refresh     func(registered, rotated TokenResponse) string
+		wantStatus  int
+		wantCode    string
+		wantRevoked bool
+	}{
+		{
+			name:       "current token",
+			refresh:    func(_, rotated TokenResponse) string { return rotated.RefreshToken },
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:        "reused token revokes the session",
+			refresh:     func(registered, _ TokenResponse) string { return registered.RefreshToken },
+			wantStatus:  http.StatusUnauthorized,
+			wantCode:    CodeUnauthorized,
+			wantRevoked: true,
+		},
+		{
+			name:       "unknown token",
+			refresh:    func(_, _ TokenResponse) string { return "no-such-token" },
+			wantStatus: http.StatusUnauthorized,
+			wantCode:   CodeUnauthorized,
+		},
+		{
+			name:       "missing token",
+			refresh:    func(_, _ TokenResponse) string { return "" },
+			wantStatus: http.StatusBadRequest,
+			wantCode:   CodeValidationFailed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestServer(t)
+			registered := register(t, s, "alice")
+			recorder := do(t, s, http.MethodPost, "/token/refresh", "", refreshBody{RefreshToken: registered.RefreshToken})
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("first refresh: %d %s", recorder.Code, recorder.Body.String())
+			}
+			rotated := decode[TokenResponse](t, recorder)
+
+			recorder = do(t, s, http.MethodPost, "/token/refresh", "", refreshBody{RefreshToken: tt.refresh(registered, rotated)})
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("got %d %s, want %d", recorder.Code, recorder.Body.String(), tt.wantStatus)
+			}
+			if tt.wantCode != "" {
+				if got := decode[ErrorResponse](t, recorder).Code; got != tt.wantCode {
+					t.Errorf("code = %q, want %q", got, tt.wantCode)
+				}
+			}
+
+			wantAccess := http.StatusOK
+			if tt.wantRevoked {
+				wantAccess = http.StatusUnauthorized
+			}
+			if got := do(t, s, http.MethodGet, "/user/sessions", rotated.AccessToken, nil).Code; got != wantAccess {
+				t.Errorf("access token of the session: got %d, want %d", got, wantAccess)
+			}
+			if tt.wantRevoked {
+				recorder := do(t, s, http.MethodPost, "/token/refresh", "", refreshBody{RefreshToken: rotated.RefreshToken})
+				if recorder.Code != http.StatusUnauthorized {
+					t.Errorf("refresh token of the revoked session: got %d, want 401", recorder.Code)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,227 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mhghw/fara-message/db"
+	"github.com/mhghw/fara-message/throttle"
+)
+
+// Two-factor login: when the password is right and the user has confirmed a
+// TOTP enrollment, loginHandler answers with an MFA token instead of a token
+// pair. The client trades it together with a code, or a recovery code, for
+// the token pair at POST /login/2fa.
+
+type TwoFactorEnrollResponse struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type MFAChallengeResponse struct {
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+type twoFactorCodeBody struct {
+	Code         string `json:"code" validate:"required_without=RecoveryCode"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+type twoFactorLoginBody struct {
+	MFAToken string `json:"mfa_token" validate:"required"`
+	twoFactorCodeBody
+}
+
+// twoFactorEnabled reports whether userID has to pass a second factor.
+func (s *Server) twoFactorEnabled(userID string) (bool, error) {
+	twoFactor, err := s.store.GetTwoFactor(userID)
+	if errors.Is(err, db.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return twoFactor.ConfirmedTime.Valid, nil
+}
+
+// verifySecondFactor checks a TOTP code or, if none is given, a recovery code of
+// a confirmed enrollment. Either is accepted only once.
+func (s *Server) verifySecondFactor(userID string, body twoFactorCodeBody) (bool, error) {
+	twoFactor, err := s.store.GetTwoFactor(userID)
+	if errors.Is(err, db.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if !twoFactor.ConfirmedTime.Valid {
+		return false, nil
+	}
+	if body.Code != "" {
+		step, ok := matchTOTP(twoFactor.Secret, body.Code, time.Now())
+		if !ok {
+			return false, nil
+		}
+		return s.store.UseTOTPStep(userID, step)
+	}
+	if body.RecoveryCode != "" {
+		return s.store.UseRecoveryCode(userID, hashToken(normalizeRecoveryCode(body.RecoveryCode)))
+	}
+	return false, nil
+}
+
+func (s *Server) mfaChallenge(c *gin.Context, userID string, deviceName string) {
+	mfaToken, err := s.tokens.CreateMFAToken(userID, deviceName)
+	if err != nil {
+		respondError(c, fmt.Errorf("failed to create token: %w", err))
+		return
+	}
+	c.JSON(http.StatusOK, MFAChallengeResponse{
+		MFARequired: true,
+		MFAToken:    mfaToken,
+		ExpiresIn:   int(s.config.Auth.MFATokenLifetime.Std().Seconds()),
+	})
+}
+
+// TwoFactorLoginHandler finishes a login that loginHandler answered with an
+// MFA token.
+func (s *Server) TwoFactorLoginHandler(c *gin.Context) {
+	var body twoFactorLoginBody
+	if !s.bindJSON(c, &body) {
+		return
+	}
+	claims, err := s.tokens.ParseMFAToken(body.MFAToken)
+	if err != nil {
+		log.Printf("failed to validate MFA token: %v", err)
+		respondError(c, errUnauthorized("invalid or expired mfa_token"))
+		return
+	}
+	// Codes are only six digits, so they get a throttle of their own.
+	key := throttle.MFAKey(claims.UserID)
+	if !s.checkLoginThrottle(c, key) {
+		return
+	}
+	ok, err := s.verifySecondFactor(claims.UserID, body.twoFactorCodeBody)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if !ok {
+		s.loginFailed(c, key, claims.UserID, "", errUnauthorized("invalid code"))
+		return
+	}
+	s.loginSucceeded(c, key, claims.UserID, "")
+	tokens, err := s.issueTokens(c, claims.UserID, claims.DeviceName)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, tokens)
+}
+
+// EnrollTwoFactorHandler generates a TOTP secret for the caller. It takes
+// effect once confirmed with a code from the authenticator app.
+func (s *Server) EnrollTwoFactorHandler(c *gin.Context) {
+	principal := currentPrincipal(c)
+	enabled, err := s.twoFactorEnabled(principal.UserID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if enabled {
+		respondError(c, errConflict("two-factor authentication is already enabled"))
+		return
+	}
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		respondError(c, fmt.Errorf("failed to generate secret: %w", err))
+		return
+	}
+	if err := s.store.SaveTwoFactorSecret(principal.UserID, secret); err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, TwoFactorEnrollResponse{
+		Secret:     secret,
+		OTPAuthURI: totpURI(s.config.Auth.TOTPIssuer, principal.User.Username, secret),
+	})
+}
+
+// ConfirmTwoFactorHandler turns two-factor authentication on and returns the
+// recovery codes. They are shown this once; only their hashes are kept.
+func (s *Server) ConfirmTwoFactorHandler(c *gin.Context) {
+	principal := currentPrincipal(c)
+	var body twoFactorCodeBody
+	if !s.bindJSON(c, &body) {
+		return
+	}
+	twoFactor, err := s.store.GetTwoFactor(principal.UserID)
+	if errors.Is(err, db.ErrNotFound) || (err == nil && twoFactor.ConfirmedTime.Valid) {
+		respondError(c, errConflict("no two-factor enrollment to confirm"))
+		return
+	}
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	step, ok := matchTOTP(twoFactor.Secret, body.Code, time.Now())
+	if !ok {
+		respondError(c, errValidation("invalid code"))
+		return
+	}
+	codes, err := generateRecoveryCodes()
+	if err != nil {
+		respondError(c, fmt.Errorf("failed to generate recovery codes: %w", err))
+		return
+	}
+	hashes := make([]string, 0, len(codes))
+	for _, code := range codes {
+		hashes = append(hashes, hashToken(normalizeRecoveryCode(code)))
+	}
+	if err := s.store.ConfirmTwoFactor(principal.UserID, step, hashes); err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// DisableTwoFactorHandler turns two-factor authentication off. It takes a
+// current code or a recovery code, so a stolen access token alone is not
+// enough.
+func (s *Server) DisableTwoFactorHandler(c *gin.Context) {
+	principal := currentPrincipal(c)
+	var body twoFactorCodeBody
+	if !s.bindJSON(c, &body) {
+		return
+	}
+	// Guessing codes here is as good as at login, so both share a throttle.
+	key := throttle.MFAKey(principal.UserID)
+	if !s.checkLoginThrottle(c, key) {
+		return
+	}
+	ok, err := s.verifySecondFactor(principal.UserID, body)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if !ok {
+		s.loginFailed(c, key, principal.UserID, principal.User.Username, errValidation("invalid code"))
+		return
+	}
+	s.clearLoginThrottle(c, key)
+	if err := s.store.DeleteTwoFactor(principal.UserID); err != nil {
+		respondError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
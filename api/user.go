@@ -1,73 +1,67 @@
 package api
 
 import (
-	"fmt"
-	"log"
+	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"github.com/mhghw/fara-message/db"
 )
 
+// UpdateUserForm holds the fields to change; empty ones are left alone. The
+// email address is changed through POST /user/email and the password
+// through POST /user/change_password, which both want the current password.
+type UpdateUserForm struct {
+	Username  string `json:"username" validate:"omitempty,username"`
+	FirstName string `json:"first_name" validate:"omitempty,name"`
+	LastName  string `json:"last_name" validate:"omitempty,name"`
+	Gender    string `json:"gender" validate:"omitempty,gender"`
+}
+
 type UsernameType struct {
 	Username string `json:"username"`
 }
 
-func ReadUserHandler(c *gin.Context) {
-	authorizationHeader := c.GetHeader("Authorization")
-	userID, err := ValidateToken(authorizationHeader)
-	if err != nil {
-		log.Printf("failed to validate token: %v", err)
-		return
-	}
-	log.Println(userID)
-	userTable, err := db.Mysql.ReadUser(userID)
-	if err != nil {
-		log.Printf("failed to read user: %v", err)
-		return
-	}
+func (s *Server) ReadUserHandler(c *gin.Context) {
+	userTable := currentPrincipal(c).User
 	RegisterForm := convertUserTableToRegisterForm(userTable)
 	c.JSON(http.StatusOK, RegisterForm)
 
 }
 
-func UpdateUserHandler(c *gin.Context) {
-	tokenString := c.GetHeader("Authorization")
-	userID, err := ValidateToken(tokenString)
-	if err != nil {
-		log.Printf("error validating user: %v", err)
-		c.JSON(400, "error validating user")
-
-		return
-	}
-	oldUser, err := db.Mysql.ReadUser(userID)
-	if err != nil {
-		log.Printf("error reading user:%v", err)
-		c.JSON(400, "error reading user")
+func (s *Server) UpdateUserHandler(c *gin.Context) {
+	userID := currentPrincipal(c).UserID
+	oldUserRegisterForm := convertUserTableToRegisterForm(currentPrincipal(c).User)
+	var newInfoRequest UpdateUserForm
+	if !s.bindJSON(c, &newInfoRequest) {
 		return
 	}
-	oldUserRegisterForm := convertUserTableToRegisterForm(oldUser)
-	var newInfoRequest RegisterForm
-	err = c.BindJSON(&newInfoRequest)
+	if newInfoRequest.Username != "" {
+		owner, err := s.store.ReadUserByUsername(newInfoRequest.Username)
+		if err != nil && !errors.Is(err, db.ErrNotFound) {
+			respondError(c, err)
+			return
+		}
+		if err == nil && owner.ID != userID {
+			respondError(c, errConflict("username is already taken"))
+			return
+		}
+	}
+
+	user, err := convertRegisterFormToUser(RegisterForm{
+		Username:    newInfoRequest.Username,
+		FirstName:   newInfoRequest.FirstName,
+		LastName:    newInfoRequest.LastName,
+		Gender:      newInfoRequest.Gender,
+		DateOfBirth: oldUserRegisterForm.DateOfBirth,
+	}, s.passwords)
 	if err != nil {
-		log.Printf("error binding JSON:%v", err)
-		c.Status(400)
-		return
-	}
-	newInfoRequest.DateOfBirth = oldUserRegisterForm.DateOfBirth
-
-	user, err := convertRegisterFormToUser(newInfoRequest)
-	if err != nil {
-		log.Printf("error converting registerForm to user:%v", err)
-		c.Status(400)
+		respondError(c, err)
 		return
 	}
 	newUserTable := db.ConvertUserToUserTable(user)
-	fmt.Println(newUserTable)
-	err = db.Mysql.UpdateUser(userID, newUserTable)
-	if err != nil {
-		log.Printf("error updating user:%v", err)
-		c.Status(400)
+	if err := s.store.UpdateUser(userID, newUserTable); err != nil {
+		respondError(c, err)
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{
@@ -76,21 +70,11 @@ func UpdateUserHandler(c *gin.Context) {
 
 }
 
-func DeleteUserHandler(c *gin.Context) {
-	authorizationHeader := c.GetHeader("Authorization")
-	userID, err := ValidateToken(authorizationHeader)
-	if err != nil {
-		log.Printf("error validating token: %v", err)
-		c.Status(400)
-		return
-	}
+func (s *Server) DeleteUserHandler(c *gin.Context) {
+	userID := currentPrincipal(c).UserID
 
-	err = db.Mysql.DeleteUser(userID)
-	if err != nil {
-		log.Printf("failed to delete user:%v", err)
-		c.JSON(http.StatusOK, gin.H{
-			"message": fmt.Sprintf("failed to delete user:%v", err),
-		})
+	if err := s.store.DeleteUser(userID); err != nil {
+		respondError(c, err)
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{
@@ -99,38 +83,24 @@ func DeleteUserHandler(c *gin.Context) {
 
 }
 
-func addContactHandler(c *gin.Context) {
-	authorizationHeader := c.GetHeader("Authorization")
-	userID, err := ValidateToken(authorizationHeader)
-	if err != nil {
-		log.Printf("error validating token: %v", err)
-		c.Status(400)
+func (s *Server) addContactHandler(c *gin.Context) {
+	userID := currentPrincipal(c).UserID
+	contactID := c.Param("id")
+	if _, err := s.store.ReadUser(contactID); err != nil {
+		respondError(c, err)
 		return
 	}
-	contactID := c.Param("id")
-	if err := db.Mysql.AddContact(userID, contactID); err != nil {
-		log.Printf("failed to add contact:%v", err)
-		c.JSON(400, gin.H{
-			"error": fmt.Sprintf("%v", err),
-		})
+	if err := s.store.AddContact(userID, contactID); err != nil {
+		respondError(c, err)
 		return
 	}
 	c.JSON(200, "contact added successfully")
 }
-func GetUserContactsHandler(c *gin.Context) {
-	authorizationHeader := c.GetHeader("Authorization")
-	userID, err := ValidateToken(authorizationHeader)
-	if err != nil {
-		log.Printf("error validating token: %v", err)
-		c.Status(400)
-		return
-	}
-	contactsDB, err := db.Mysql.GetUserContacts(userID)
+func (s *Server) GetUserContactsHandler(c *gin.Context) {
+	userID := currentPrincipal(c).UserID
+	contactsDB, err := s.store.GetUserContacts(userID)
 	if err != nil {
-		log.Printf("failed to get contacts:%v", err)
-		c.JSON(400, gin.H{
-			"error": fmt.Sprintf("%v", err),
-		})
+		respondError(c, err)
 		return
 	}
 	var contacts []Contact
@@ -145,20 +115,11 @@ func GetUserContactsHandler(c *gin.Context) {
 	c.JSON(200, contactResponse)
 }
 
-func DeleteContactHandler(c *gin.Context) {
-	authorizationHeader := c.GetHeader("Authorization")
-	userID, err := ValidateToken(authorizationHeader)
-	if err != nil {
-		log.Printf("error validating token: %v", err)
-		c.Status(400)
-		return
-	}
+func (s *Server) DeleteContactHandler(c *gin.Context) {
+	userID := currentPrincipal(c).UserID
 	contactID := c.Param("id")
-	if err := db.Mysql.DeleteContact(userID, contactID); err != nil {
-		log.Printf("failed to delete contact:%v", err)
-		c.JSON(400, gin.H{
-			"error": fmt.Sprintf("%v", err),
-		})
+	if err := s.store.DeleteContact(userID, contactID); err != nil {
+		respondError(c, err)
 		return
 	}
 	c.JSON(200, "contact deleted successfully")
@@ -0,0 +1,38 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestUpdateUserRejectsTakenUsername(t *testing.T) {
+	s, _ := newTestServer(t)
+	alice := register(t, s, "alice")
+	register(t, s, "bobby")
+
+	recorder := do(t, s, http.MethodPost, "/user/update", alice.AccessToken, UpdateUserForm{Username: "bobby"})
+	if recorder.Code != http.StatusConflict {
+		t.Errorf("taken username: got %d %s, want 409", recorder.Code, recorder.Body.String())
+	}
+	recorder = do(t, s, http.MethodPost, "/user/update", alice.AccessToken, UpdateUserForm{Username: "alice", FirstName: "Alicia"})
+	if recorder.Code != http.StatusOK {
+		t.Errorf("own username: got %d %s, want 200", recorder.Code, recorder.Body.String())
+	}
+}
+
+func TestChangePasswordIsThrottled(t *testing.T) {
+	s, _ := newTestServer(t)
+	alice := register(t, s, "alice")
+	body := UserData{CurrentPassword: "wrong", Password: "password2", ConfirmPassword: "password2"}
+
+	delayAfter := s.config.Auth.LoginThrottle.DelayAfter
+	for i := 0; i < delayAfter; i++ {
+		if recorder := do(t, s, http.MethodPost, "/user/change_password", alice.AccessToken, body); recorder.Code != http.StatusBadRequest {
+			t.Fatalf("guess %d: got %d %s, want 400", i+1, recorder.Code, recorder.Body.String())
+		}
+	}
+	body.CurrentPassword = "password1"
+	if recorder := do(t, s, http.MethodPost, "/user/change_password", alice.AccessToken, body); recorder.Code != http.StatusTooManyRequests {
+		t.Errorf("after %d wrong guesses: got %d %s, want 429", delayAfter, recorder.Code, recorder.Body.String())
+	}
+}
@@ -0,0 +1,192 @@
+package api
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/mhghw/fara-message/config"
+)
+
+// Request bodies declare their rules in validate struct tags. Next to the
+// validator's built-in tags there are custom ones for the rules of the
+// users section of the configuration, so that each is defined once:
+//
+//	username       length and pattern of a username
+//	password       length of a new password
+//	name           length of a first or last name
+//	email_address  an email address
+//	date_of_birth  a YYYY-MM-DD date at least users.min_age years ago
+//	gender         male, female or non binary
+//	handle         a channel handle
+
+// FieldError is one entry in the details of a validation_failed response.
+// Field is the name of the field in the request body.
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+var channelHandlePattern = regexp.MustCompile(`^[A-Za-z0-9_]{3,32}$`)
+
+type requestValidator struct {
+	validate        *validator.Validate
+	rules           config.Users
+	usernamePattern *regexp.Regexp
+}
+
+func newRequestValidator(rules config.Users) (*requestValidator, error) {
+	usernamePattern, err := regexp.Compile(rules.UsernamePattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid username pattern: %w", err)
+	}
+	v := &requestValidator{
+		validate:        validator.New(validator.WithRequiredStructEnabled()),
+		rules:           rules,
+		usernamePattern: usernamePattern,
+	}
+	v.validate.RegisterTagNameFunc(jsonFieldName)
+	custom := map[string]validator.Func{
+		"username": func(fl validator.FieldLevel) bool {
+			username := fl.Field().String()
+			return lengthBetween(username, rules.UsernameMinLength, rules.UsernameMaxLength) && usernamePattern.MatchString(username)
+		},
+		"password": func(fl validator.FieldLevel) bool {
+			return lengthBetween(fl.Field().String(), rules.PasswordMinLength, rules.PasswordMaxLength)
+		},
+		"name": func(fl validator.FieldLevel) bool {
+			return lengthBetween(strings.TrimSpace(fl.Field().String()), rules.NameMinLength, rules.NameMaxLength)
+		},
+		"email_address": func(fl validator.FieldLevel) bool {
+			return IsValidEmail(fl.Field().String())
+		},
+		"date_of_birth": func(fl validator.FieldLevel) bool {
+			date, err := time.Parse(time.DateOnly, fl.Field().String())
+			return err == nil && !date.After(time.Now().AddDate(-rules.MinAge, 0, 0))
+		},
+		"handle": func(fl validator.FieldLevel) bool {
+			return channelHandlePattern.MatchString(fl.Field().String())
+		},
+		"gender": func(fl validator.FieldLevel) bool {
+			switch strings.ToLower(fl.Field().String()) {
+			case "male", "female", "non binary":
+				return true
+			}
+			return false
+		},
+	}
+	for tag, fn := range custom {
+		if err := v.validate.RegisterValidation(tag, fn); err != nil {
+			return nil, err
+		}
+	}
+	return v, nil
+}
+
+// check validates obj against its validate tags. It returns a
+// validation_failed APIError listing every field that is off, or nil.
+func (v *requestValidator) check(obj any) error {
+	err := v.validate.Struct(obj)
+	if err == nil {
+		return nil
+	}
+	fieldErrs, ok := err.(validator.ValidationErrors)
+	if !ok {
+		return err
+	}
+	fields := make([]FieldError, 0, len(fieldErrs))
+	for _, fe := range fieldErrs {
+		fields = append(fields, FieldError{
+			Field:   fe.Field(),
+			Rule:    fe.Tag(),
+			Message: fe.Field() + " " + v.message(fe),
+		})
+	}
+	apiErr := errValidation(fields[0].Message)
+	apiErr.Details = fields
+	return apiErr
+}
+
+func (v *requestValidator) message(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required", "required_without":
+		return "is required"
+	case "username":
+		return fmt.Sprintf("must be %d to %d characters long and match %s", v.rules.UsernameMinLength, v.rules.UsernameMaxLength, v.rules.UsernamePattern)
+	case "password":
+		return fmt.Sprintf("must be %d to %d characters long", v.rules.PasswordMinLength, v.rules.PasswordMaxLength)
+	case "name":
+		return fmt.Sprintf("must be %d to %d characters long", v.rules.NameMinLength, v.rules.NameMaxLength)
+	case "email_address":
+		return "must be a valid email address"
+	case "date_of_birth":
+		if v.rules.MinAge > 0 {
+			return fmt.Sprintf("must be a date like 2006-01-02 at least %d years ago", v.rules.MinAge)
+		}
+		return "must be a date like 2006-01-02, not in the future"
+	case "gender":
+		return "must be male, female or non binary"
+	case "handle":
+		return "must be 3 to 32 letters, digits or underscores"
+	case "eqfield":
+		return "does not match " + strings.ToLower(fe.Param())
+	case "max":
+		switch fe.Kind() {
+		case reflect.Slice:
+			return "must have at most " + fe.Param() + " entries"
+		case reflect.String:
+			return "must be at most " + fe.Param() + " characters long"
+		}
+		return "must be at most " + fe.Param()
+	case "min":
+		switch fe.Kind() {
+		case reflect.Slice:
+			return "must have at least " + fe.Param() + " entries"
+		case reflect.String:
+			return "must be at least " + fe.Param() + " characters long"
+		}
+		return "must be at least " + fe.Param()
+	case "oneof":
+		return "must be one of " + strings.ReplaceAll(fe.Param(), " ", ", ")
+	case "numeric":
+		return "must be a number"
+	}
+	return "is invalid"
+}
+
+// bindJSON decodes the request body into obj and validates it. If either
+// fails it responds with 400, or 413 for a body over
+// server.max_body_bytes, and returns false.
+func (s *Server) bindJSON(c *gin.Context, obj any) bool {
+	if err := c.ShouldBindJSON(obj); err != nil {
+		respondError(c, convertBindError(err))
+		return false
+	}
+	if err := s.validator.check(obj); err != nil {
+		respondError(c, err)
+		return false
+	}
+	return true
+}
+
+func jsonFieldName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "-" {
+		return ""
+	}
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
+
+func lengthBetween(value string, min int, max int) bool {
+	length := utf8.RuneCountInString(value)
+	return length >= min && length <= max
+}
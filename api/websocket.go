@@ -0,0 +1,90 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/mhghw/fara-message/realtime"
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	// Clients authenticate with a bearer token rather than cookies, so a
+	// cross-origin page gains nothing it could not already do.
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// WebSocketHandler upgrades the connection and pushes every event addressed
+// to the user until either side hangs up.
+func (s *Server) WebSocketHandler(c *gin.Context) {
+	principal, ok := s.authenticateStream(c)
+	if !ok {
+		return
+	}
+
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		log.Printf("failed to upgrade to websocket: %v", err)
+		return
+	}
+	sub := s.hub.Subscribe(principal.UserID, principal.SessionID)
+	go s.readPump(conn, sub)
+	s.writePump(conn, sub)
+}
+
+// readPump only exists to process control frames and notice when the client
+// goes away; clients send messages through the HTTP API.
+func (s *Server) readPump(conn *websocket.Conn, sub *realtime.Subscription) {
+	defer s.hub.Unsubscribe(sub)
+	pongWait := 2 * s.config.Realtime.PingInterval.Std()
+	conn.SetReadLimit(512)
+	conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
+
+func (s *Server) writePump(conn *websocket.Conn, sub *realtime.Subscription) {
+	writeTimeout := s.config.Realtime.WriteTimeout.Std()
+	ticker := time.NewTicker(s.config.Realtime.PingInterval.Std())
+	defer func() {
+		ticker.Stop()
+		conn.Close()
+	}()
+	for {
+		select {
+		case event, ok := <-sub.C:
+			conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+			if !ok {
+				code, reason := websocket.CloseGoingAway, "server closing"
+				if sub.Dropped() {
+					code, reason = websocket.CloseTryAgainLater, "slow consumer"
+				}
+				if sub.Ended() {
+					code, reason = websocket.ClosePolicyViolation, "session ended"
+				}
+				conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason))
+				return
+			}
+			if err := conn.WriteJSON(event); err != nil {
+				s.hub.Unsubscribe(sub)
+				return
+			}
+		case <-ticker.C:
+			conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				s.hub.Unsubscribe(sub)
+				return
+			}
+		}
+	}
+}
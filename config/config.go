@@ -0,0 +1,470 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// Config is the complete runtime configuration of the messenger. Values are
+// layered: Default, then the config file, then FARA_* environment variables,
+// then command line flags. See Load.
+type Config struct {
+	Server    Server    `yaml:"server" toml:"server"`
+	Database  Database  `yaml:"database" toml:"database"`
+	Auth      Auth      `yaml:"auth" toml:"auth"`
+	Users     Users     `yaml:"users" toml:"users"`
+	Realtime  Realtime  `yaml:"realtime" toml:"realtime"`
+	Chat      Chat      `yaml:"chat" toml:"chat"`
+	Mail      Mail      `yaml:"mail" toml:"mail"`
+	RateLimit RateLimit `yaml:"rate_limit" toml:"rate_limit"`
+}
+
+type Server struct {
+	Port              int      `yaml:"port" toml:"port" env:"FARA_SERVER_PORT"`
+	ReadTimeout       Duration `yaml:"read_timeout" toml:"read_timeout" env:"FARA_SERVER_READ_TIMEOUT"`
+	ReadHeaderTimeout Duration `yaml:"read_header_timeout" toml:"read_header_timeout" env:"FARA_SERVER_READ_HEADER_TIMEOUT"`
+	WriteTimeout      Duration `yaml:"write_timeout" toml:"write_timeout" env:"FARA_SERVER_WRITE_TIMEOUT"`
+	IdleTimeout       Duration `yaml:"idle_timeout" toml:"idle_timeout" env:"FARA_SERVER_IDLE_TIMEOUT"`
+	ShutdownTimeout   Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout" env:"FARA_SERVER_SHUTDOWN_TIMEOUT"`
+	MaxHeaderBytes    int      `yaml:"max_header_bytes" toml:"max_header_bytes" env:"FARA_SERVER_MAX_HEADER_BYTES"`
+	MaxBodyBytes      int64    `yaml:"max_body_bytes" toml:"max_body_bytes" env:"FARA_SERVER_MAX_BODY_BYTES"`
+	// TrustedProxies is a comma separated list of the IPs or CIDRs of
+	// reverse proxies whose X-Forwarded-For header names the client. With
+	// none, the client is whoever opened the connection.
+	TrustedProxies string `yaml:"trusted_proxies" toml:"trusted_proxies" env:"FARA_SERVER_TRUSTED_PROXIES"`
+}
+
+type Database struct {
+	Driver          string   `yaml:"driver" toml:"driver" env:"FARA_DATABASE_DRIVER"`
+	DSN             string   `yaml:"dsn" toml:"dsn" env:"FARA_DATABASE_DSN"`
+	MaxOpenConns    int      `yaml:"max_open_conns" toml:"max_open_conns" env:"FARA_DATABASE_MAX_OPEN_CONNS"`
+	MaxIdleConns    int      `yaml:"max_idle_conns" toml:"max_idle_conns" env:"FARA_DATABASE_MAX_IDLE_CONNS"`
+	ConnMaxLifetime Duration `yaml:"conn_max_lifetime" toml:"conn_max_lifetime" env:"FARA_DATABASE_CONN_MAX_LIFETIME"`
+	// MigrateOnStart applies pending migrations when the server boots.
+	// Without it the server refuses to start on an outdated schema and
+	// migrations are run explicitly with `migrate up`.
+	MigrateOnStart bool `yaml:"migrate_on_start" toml:"migrate_on_start" env:"FARA_DATABASE_MIGRATE_ON_START"`
+}
+
+type Auth struct {
+	// JWTSecret is only used when signing.algorithm is HS256.
+	JWTSecret string  `yaml:"jwt_secret" toml:"jwt_secret" env:"FARA_AUTH_JWT_SECRET"`
+	Signing   Signing `yaml:"signing" toml:"signing"`
+	// TokenIssuer and TokenAudience go into the iss and aud claims of
+	// access tokens. Services verifying them with the published keys
+	// should check both.
+	TokenIssuer   string `yaml:"token_issuer" toml:"token_issuer" env:"FARA_AUTH_TOKEN_ISSUER"`
+	TokenAudience string `yaml:"token_audience" toml:"token_audience" env:"FARA_AUTH_TOKEN_AUDIENCE"`
+	// AccessTokenLifetime bounds how long a stolen access token is useful;
+	// clients stay logged in by trading their refresh token for a new pair.
+	AccessTokenLifetime  Duration     `yaml:"access_token_lifetime" toml:"access_token_lifetime" env:"FARA_AUTH_ACCESS_TOKEN_LIFETIME"`
+	RefreshTokenLifetime Duration     `yaml:"refresh_token_lifetime" toml:"refresh_token_lifetime" env:"FARA_AUTH_REFRESH_TOKEN_LIFETIME"`
+	PasswordHash         PasswordHash `yaml:"password_hash" toml:"password_hash"`
+	// MFATokenLifetime is how long a user with two-factor authentication
+	// has after entering the password to enter a code.
+	MFATokenLifetime Duration `yaml:"mfa_token_lifetime" toml:"mfa_token_lifetime" env:"FARA_AUTH_MFA_TOKEN_LIFETIME"`
+	// TOTPIssuer is the account label authenticator apps show.
+	TOTPIssuer            string   `yaml:"totp_issuer" toml:"totp_issuer" env:"FARA_AUTH_TOTP_ISSUER"`
+	PasswordResetLifetime Duration `yaml:"password_reset_lifetime" toml:"password_reset_lifetime" env:"FARA_AUTH_PASSWORD_RESET_LIFETIME"`
+	// EmailVerificationLifetime is how long a verification link works.
+	EmailVerificationLifetime Duration `yaml:"email_verification_lifetime" toml:"email_verification_lifetime" env:"FARA_AUTH_EMAIL_VERIFICATION_LIFETIME"`
+	// PasswordResetURL is the page of the client app that takes the reset
+	// token. The token is appended as the token query parameter; when empty
+	// the email only contains the token itself.
+	PasswordResetURL string `yaml:"password_reset_url" toml:"password_reset_url" env:"FARA_AUTH_PASSWORD_RESET_URL"`
+	// EmailVerificationURL works like PasswordResetURL for verification
+	// links.
+	EmailVerificationURL string        `yaml:"email_verification_url" toml:"email_verification_url" env:"FARA_AUTH_EMAIL_VERIFICATION_URL"`
+	LoginThrottle        LoginThrottle `yaml:"login_throttle" toml:"login_throttle"`
+}
+
+// LoginThrottle limits password and two-factor attempts. After DelayAfter
+// failures an account has to wait BaseDelay, doubling with every further
+// failure up to MaxDelay; at LockoutThreshold failures it is locked for
+// LockoutDuration. A client IP is locked the same way after
+// IPLockoutThreshold failures across all accounts. Failures are forgotten
+// after Window without any.
+type LoginThrottle struct {
+	Window             Duration `yaml:"window" toml:"window" env:"FARA_AUTH_LOGIN_THROTTLE_WINDOW"`
+	DelayAfter         int      `yaml:"delay_after" toml:"delay_after" env:"FARA_AUTH_LOGIN_THROTTLE_DELAY_AFTER"`
+	BaseDelay          Duration `yaml:"base_delay" toml:"base_delay" env:"FARA_AUTH_LOGIN_THROTTLE_BASE_DELAY"`
+	MaxDelay           Duration `yaml:"max_delay" toml:"max_delay" env:"FARA_AUTH_LOGIN_THROTTLE_MAX_DELAY"`
+	LockoutThreshold   int      `yaml:"lockout_threshold" toml:"lockout_threshold" env:"FARA_AUTH_LOGIN_THROTTLE_LOCKOUT_THRESHOLD"`
+	LockoutDuration    Duration `yaml:"lockout_duration" toml:"lockout_duration" env:"FARA_AUTH_LOGIN_THROTTLE_LOCKOUT_DURATION"`
+	IPLockoutThreshold int      `yaml:"ip_lockout_threshold" toml:"ip_lockout_threshold" env:"FARA_AUTH_LOGIN_THROTTLE_IP_LOCKOUT_THRESHOLD"`
+}
+
+// Signing selects how access and MFA tokens are signed. With EdDSA or RS256 the
+// private keys are PEM files named <kid>.pem in KeyDir; the newest signs and
+// older ones keep verifying for GracePeriod after they were replaced. Without
+// a KeyDir keys are generated in memory and lost on restart, which ends every
+// access token and half-finished two-factor login.
+type Signing struct {
+	Algorithm string `yaml:"algorithm" toml:"algorithm" env:"FARA_AUTH_SIGNING_ALGORITHM"`
+	KeyDir    string `yaml:"key_dir" toml:"key_dir" env:"FARA_AUTH_SIGNING_KEY_DIR"`
+	// RotationInterval is how old the newest key may get before a new one
+	// is generated; 0 leaves rotation to the operator.
+	RotationInterval Duration `yaml:"rotation_interval" toml:"rotation_interval" env:"FARA_AUTH_SIGNING_ROTATION_INTERVAL"`
+	GracePeriod      Duration `yaml:"grace_period" toml:"grace_period" env:"FARA_AUTH_SIGNING_GRACE_PERIOD"`
+}
+
+// minJWTSecretLength is the size of the HS256 hash; a shorter secret is
+// easier to guess than the signature is to forge.
+const minJWTSecretLength = 32
+
+const (
+	AlgorithmEdDSA = "EdDSA"
+	AlgorithmRS256 = "RS256"
+	AlgorithmHS256 = "HS256"
+)
+
+// PasswordHash holds the argon2id cost parameters. Raising them makes every
+// stored hash with lower ones get rehashed at the user's next login.
+type PasswordHash struct {
+	MemoryKiB   int `yaml:"memory_kib" toml:"memory_kib" env:"FARA_AUTH_PASSWORD_HASH_MEMORY_KIB"`
+	Iterations  int `yaml:"iterations" toml:"iterations" env:"FARA_AUTH_PASSWORD_HASH_ITERATIONS"`
+	Parallelism int `yaml:"parallelism" toml:"parallelism" env:"FARA_AUTH_PASSWORD_HASH_PARALLELISM"`
+}
+
+// Users holds the rules applied to new and changed account details. Lengths
+// count characters, not bytes.
+type Users struct {
+	UsernameMinLength int `yaml:"username_min_length" toml:"username_min_length" env:"FARA_USERS_USERNAME_MIN_LENGTH"`
+	UsernameMaxLength int `yaml:"username_max_length" toml:"username_max_length" env:"FARA_USERS_USERNAME_MAX_LENGTH"`
+	// UsernamePattern is a regular expression every username has to match.
+	UsernamePattern   string `yaml:"username_pattern" toml:"username_pattern" env:"FARA_USERS_USERNAME_PATTERN"`
+	PasswordMinLength int    `yaml:"password_min_length" toml:"password_min_length" env:"FARA_USERS_PASSWORD_MIN_LENGTH"`
+	PasswordMaxLength int    `yaml:"password_max_length" toml:"password_max_length" env:"FARA_USERS_PASSWORD_MAX_LENGTH"`
+	// NameMinLength and NameMaxLength apply to first and last names.
+	NameMinLength int `yaml:"name_min_length" toml:"name_min_length" env:"FARA_USERS_NAME_MIN_LENGTH"`
+	NameMaxLength int `yaml:"name_max_length" toml:"name_max_length" env:"FARA_USERS_NAME_MAX_LENGTH"`
+	// MinAge is how many years old a user has to be to register. Zero only
+	// rules out dates of birth in the future.
+	MinAge int `yaml:"min_age" toml:"min_age" env:"FARA_USERS_MIN_AGE"`
+}
+
+// Realtime tunes the WebSocket and server-sent event streams.
+type Realtime struct {
+	// SendBuffer is how many undelivered events a connection may queue
+	// before it is treated as a slow consumer and disconnected.
+	SendBuffer int `yaml:"send_buffer" toml:"send_buffer" env:"FARA_REALTIME_SEND_BUFFER"`
+	// HistorySize is how many recent events are kept so reconnecting
+	// clients can resume from their Last-Event-ID.
+	HistorySize  int      `yaml:"history_size" toml:"history_size" env:"FARA_REALTIME_HISTORY_SIZE"`
+	WriteTimeout Duration `yaml:"write_timeout" toml:"write_timeout" env:"FARA_REALTIME_WRITE_TIMEOUT"`
+	PingInterval Duration `yaml:"ping_interval" toml:"ping_interval" env:"FARA_REALTIME_PING_INTERVAL"`
+}
+
+type Chat struct {
+	// MessagePageSize is the number of messages returned when the client
+	// does not ask for a limit; MaxMessagePageSize caps what it may ask for.
+	MessagePageSize    int `yaml:"message_page_size" toml:"message_page_size" env:"FARA_CHAT_MESSAGE_PAGE_SIZE"`
+	MaxMessagePageSize int `yaml:"max_message_page_size" toml:"max_message_page_size" env:"FARA_CHAT_MAX_MESSAGE_PAGE_SIZE"`
+	// InviteURL is the page of the client app that takes invite tokens, like
+	// auth.password_reset_url. When empty, new invites only come with the
+	// token.
+	InviteURL string `yaml:"invite_url" toml:"invite_url" env:"FARA_CHAT_INVITE_URL"`
+}
+
+// Mail selects how emails such as password reset links are delivered.
+type Mail struct {
+	// Driver is smtp, file (write .eml files into FileDir) or log.
+	Driver  string `yaml:"driver" toml:"driver" env:"FARA_MAIL_DRIVER"`
+	From    string `yaml:"from" toml:"from" env:"FARA_MAIL_FROM"`
+	FileDir string `yaml:"file_dir" toml:"file_dir" env:"FARA_MAIL_FILE_DIR"`
+	SMTP    SMTP   `yaml:"smtp" toml:"smtp"`
+}
+
+type SMTP struct {
+	Host     string `yaml:"host" toml:"host" env:"FARA_MAIL_SMTP_HOST"`
+	Port     int    `yaml:"port" toml:"port" env:"FARA_MAIL_SMTP_PORT"`
+	Username string `yaml:"username" toml:"username" env:"FARA_MAIL_SMTP_USERNAME"`
+	Password string `yaml:"password" toml:"password" env:"FARA_MAIL_SMTP_PASSWORD"`
+}
+
+// RateLimit limits how many requests a client may send per route group.
+// Authenticated requests are counted per user, the others per client IP.
+// The policies can only be set in the config file.
+type RateLimit struct {
+	Enabled bool `yaml:"enabled" toml:"enabled" env:"FARA_RATE_LIMIT_ENABLED"`
+	// Public covers the routes that need no token, such as /login and
+	// /register. Login failures are throttled separately by
+	// auth.login_throttle.
+	Public RateLimitPolicy `yaml:"public" toml:"public"`
+	// Default covers every authenticated route not in another group.
+	Default  RateLimitPolicy `yaml:"default" toml:"default"`
+	Messages RateLimitPolicy `yaml:"messages" toml:"messages"`
+	Chats    RateLimitPolicy `yaml:"chats" toml:"chats"`
+	// PasswordResetEmails limits POST /password/forgot per email address,
+	// so that it cannot be used to flood somebody's inbox.
+	PasswordResetEmails RateLimitPolicy `yaml:"password_reset_emails" toml:"password_reset_emails"`
+}
+
+// RateLimitPolicy allows Requests per Per on average and bursts of up to
+// Burst requests. Zero Requests leaves the group unlimited.
+type RateLimitPolicy struct {
+	Requests int      `yaml:"requests" toml:"requests"`
+	Per      Duration `yaml:"per" toml:"per"`
+	Burst    int      `yaml:"burst" toml:"burst"`
+}
+
+const (
+	DriverMySQL  = "mysql"
+	DriverSQLite = "sqlite"
+)
+
+const (
+	MailDriverSMTP = "smtp"
+	MailDriverFile = "file"
+	MailDriverLog  = "log"
+)
+
+// Default returns the settings used for anything not configured. There is no
+// default database DSN or JWT secret; those always have to be set.
+func Default() Config {
+	return Config{
+		Server: Server{
+			Port:              8080,
+			ReadTimeout:       Duration(15 * time.Second),
+			ReadHeaderTimeout: Duration(5 * time.Second),
+			WriteTimeout:      Duration(15 * time.Second),
+			IdleTimeout:       Duration(60 * time.Second),
+			ShutdownTimeout:   Duration(10 * time.Second),
+			MaxHeaderBytes:    1 << 20,
+			MaxBodyBytes:      1 << 20,
+		},
+		Database: Database{
+			Driver:          DriverMySQL,
+			MaxOpenConns:    25,
+			MaxIdleConns:    5,
+			ConnMaxLifetime: Duration(30 * time.Minute),
+		},
+		Auth: Auth{
+			Signing: Signing{
+				Algorithm:        AlgorithmEdDSA,
+				RotationInterval: Duration(30 * 24 * time.Hour),
+				GracePeriod:      Duration(time.Hour),
+			},
+			TokenIssuer:          "fara-message",
+			TokenAudience:        "fara-message-api",
+			AccessTokenLifetime:  Duration(15 * time.Minute),
+			RefreshTokenLifetime: Duration(30 * 24 * time.Hour),
+			PasswordHash: PasswordHash{
+				MemoryKiB:   64 * 1024,
+				Iterations:  3,
+				Parallelism: 2,
+			},
+			MFATokenLifetime:          Duration(5 * time.Minute),
+			TOTPIssuer:                "Fara Message",
+			PasswordResetLifetime:     Duration(time.Hour),
+			EmailVerificationLifetime: Duration(48 * time.Hour),
+			LoginThrottle: LoginThrottle{
+				Window:             Duration(15 * time.Minute),
+				DelayAfter:         3,
+				BaseDelay:          Duration(time.Second),
+				MaxDelay:           Duration(30 * time.Second),
+				LockoutThreshold:   10,
+				LockoutDuration:    Duration(15 * time.Minute),
+				IPLockoutThreshold: 100,
+			},
+		},
+		Users: Users{
+			UsernameMinLength: 4,
+			UsernameMaxLength: 32,
+			UsernamePattern:   `^[A-Za-z0-9_.-]+$`,
+			PasswordMinLength: 8,
+			PasswordMaxLength: 72,
+			NameMinLength:     3,
+			NameMaxLength:     64,
+		},
+		Realtime: Realtime{
+			SendBuffer:   64,
+			HistorySize:  1024,
+			WriteTimeout: Duration(10 * time.Second),
+			PingInterval: Duration(30 * time.Second),
+		},
+		Chat: Chat{
+			MessagePageSize:    50,
+			MaxMessagePageSize: 200,
+		},
+		Mail: Mail{
+			Driver: MailDriverLog,
+			From:   "Fara Message <no-reply@localhost>",
+			SMTP: SMTP{
+				Port: 587,
+			},
+		},
+		RateLimit: RateLimit{
+			Enabled:             true,
+			Public:              RateLimitPolicy{Requests: 30, Per: Duration(time.Minute), Burst: 10},
+			Default:             RateLimitPolicy{Requests: 300, Per: Duration(time.Minute), Burst: 60},
+			Messages:            RateLimitPolicy{Requests: 60, Per: Duration(time.Minute), Burst: 20},
+			Chats:               RateLimitPolicy{Requests: 10, Per: Duration(time.Minute), Burst: 5},
+			PasswordResetEmails: RateLimitPolicy{Requests: 3, Per: Duration(time.Hour), Burst: 3},
+		},
+	}
+}
+
+// Validate reports every problem in the configuration at once.
+func (c Config) Validate() error {
+	var errs []error
+	if c.Server.Port < 1 || c.Server.Port > 65535 {
+		errs = append(errs, fmt.Errorf("server.port must be between 1 and 65535, got %d", c.Server.Port))
+	}
+	if c.Server.ReadTimeout < 0 || c.Server.ReadHeaderTimeout < 0 || c.Server.WriteTimeout < 0 || c.Server.IdleTimeout < 0 || c.Server.ShutdownTimeout < 0 {
+		errs = append(errs, errors.New("server timeouts must not be negative"))
+	}
+	if c.Server.MaxHeaderBytes < 0 || c.Server.MaxBodyBytes < 0 {
+		errs = append(errs, errors.New("server size limits must not be negative"))
+	}
+
+	if c.Database.Driver != DriverMySQL && c.Database.Driver != DriverSQLite {
+		errs = append(errs, fmt.Errorf("database.driver must be %q or %q, got %q", DriverMySQL, DriverSQLite, c.Database.Driver))
+	}
+	if c.Database.DSN == "" {
+		errs = append(errs, errors.New("database.dsn is required"))
+	}
+	if c.Database.MaxOpenConns < 0 || c.Database.MaxIdleConns < 0 || c.Database.ConnMaxLifetime < 0 {
+		errs = append(errs, errors.New("database pool settings must not be negative"))
+	}
+
+	switch c.Auth.Signing.Algorithm {
+	case AlgorithmEdDSA, AlgorithmRS256:
+	case AlgorithmHS256:
+		if len(c.Auth.JWTSecret) < minJWTSecretLength {
+			errs = append(errs, fmt.Errorf("auth.jwt_secret of at least %d bytes is required with HS256", minJWTSecretLength))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("auth.signing.algorithm must be %q, %q or %q, got %q", AlgorithmEdDSA, AlgorithmRS256, AlgorithmHS256, c.Auth.Signing.Algorithm))
+	}
+	if c.Auth.Signing.RotationInterval < 0 {
+		errs = append(errs, errors.New("auth.signing.rotation_interval must not be negative"))
+	}
+	if t := c.Auth.LoginThrottle; t.DelayAfter < 0 || t.BaseDelay < 0 || t.MaxDelay < t.BaseDelay || t.LockoutThreshold < 1 || t.IPLockoutThreshold < 1 || t.LockoutDuration <= 0 {
+		errs = append(errs, errors.New("auth.login_throttle needs positive thresholds and lockout_duration, and max_delay not below base_delay"))
+	} else if t.Window < t.LockoutDuration || t.Window < t.MaxDelay {
+		// The failures a lockout rests on must outlive it.
+		errs = append(errs, errors.New("auth.login_throttle.window must not be shorter than lockout_duration and max_delay"))
+	}
+	if c.Auth.TokenIssuer == "" || c.Auth.TokenAudience == "" {
+		errs = append(errs, errors.New("auth.token_issuer and auth.token_audience are required"))
+	}
+	if c.Auth.TOTPIssuer == "" {
+		errs = append(errs, errors.New("auth.totp_issuer is required"))
+	}
+	// A token signed just before a rotation must still verify until it
+	// expires. That goes for MFA tokens as much as for access tokens.
+	if c.Auth.Signing.GracePeriod < c.Auth.AccessTokenLifetime {
+		errs = append(errs, errors.New("auth.signing.grace_period must not be less than auth.access_token_lifetime"))
+	}
+	if c.Auth.Signing.GracePeriod < c.Auth.MFATokenLifetime {
+		errs = append(errs, errors.New("auth.signing.grace_period must not be less than auth.mfa_token_lifetime"))
+	}
+	if c.Auth.AccessTokenLifetime <= 0 || c.Auth.RefreshTokenLifetime <= 0 || c.Auth.MFATokenLifetime <= 0 || c.Auth.PasswordResetLifetime <= 0 || c.Auth.EmailVerificationLifetime <= 0 {
+		errs = append(errs, errors.New("auth token lifetimes must be positive"))
+	}
+	if c.Auth.PasswordHash.MemoryKiB < 8 || c.Auth.PasswordHash.Iterations < 1 || c.Auth.PasswordHash.Parallelism < 1 || c.Auth.PasswordHash.Parallelism > 255 {
+		errs = append(errs, errors.New("auth.password_hash needs memory_kib >= 8, iterations >= 1 and parallelism between 1 and 255"))
+	}
+
+	if c.Users.UsernameMinLength < 1 {
+		errs = append(errs, errors.New("users.username_min_length must be at least 1"))
+	}
+	if c.Users.UsernameMaxLength < c.Users.UsernameMinLength {
+		errs = append(errs, errors.New("users.username_max_length must not be less than users.username_min_length"))
+	}
+	if c.Users.PasswordMinLength < 1 {
+		errs = append(errs, errors.New("users.password_min_length must be at least 1"))
+	}
+	if c.Users.PasswordMaxLength < c.Users.PasswordMinLength {
+		errs = append(errs, errors.New("users.password_max_length must not be less than users.password_min_length"))
+	}
+	if _, err := regexp.Compile(c.Users.UsernamePattern); err != nil {
+		errs = append(errs, fmt.Errorf("users.username_pattern is not a valid regular expression: %w", err))
+	}
+	if c.Users.NameMinLength < 1 || c.Users.NameMaxLength < c.Users.NameMinLength {
+		errs = append(errs, errors.New("users.name_min_length must be at least 1 and not more than users.name_max_length"))
+	}
+	if c.Users.MinAge < 0 {
+		errs = append(errs, errors.New("users.min_age must not be negative"))
+	}
+
+	if c.Realtime.SendBuffer < 1 {
+		errs = append(errs, errors.New("realtime.send_buffer must be at least 1"))
+	}
+	if c.Realtime.HistorySize < 0 {
+		errs = append(errs, errors.New("realtime.history_size must not be negative"))
+	}
+	if c.Realtime.WriteTimeout <= 0 || c.Realtime.PingInterval <= 0 {
+		errs = append(errs, errors.New("realtime timeouts must be positive"))
+	}
+
+	if c.Chat.MessagePageSize < 1 {
+		errs = append(errs, errors.New("chat.message_page_size must be at least 1"))
+	}
+	if c.Chat.MaxMessagePageSize < c.Chat.MessagePageSize {
+		errs = append(errs, errors.New("chat.max_message_page_size must not be less than chat.message_page_size"))
+	}
+
+	switch c.Mail.Driver {
+	case MailDriverSMTP:
+		if c.Mail.SMTP.Host == "" || c.Mail.SMTP.Port < 1 || c.Mail.SMTP.Port > 65535 {
+			errs = append(errs, errors.New("mail.smtp needs a host and a port between 1 and 65535"))
+		}
+	case MailDriverFile:
+		if c.Mail.FileDir == "" {
+			errs = append(errs, errors.New("mail.file_dir is required with the file driver"))
+		}
+	case MailDriverLog:
+	default:
+		errs = append(errs, fmt.Errorf("mail.driver must be %q, %q or %q, got %q", MailDriverSMTP, MailDriverFile, MailDriverLog, c.Mail.Driver))
+	}
+
+	if c.Mail.From == "" {
+		errs = append(errs, errors.New("mail.from is required"))
+	}
+
+	policies := []struct {
+		name   string
+		policy RateLimitPolicy
+	}{
+		{"public", c.RateLimit.Public},
+		{"default", c.RateLimit.Default},
+		{"messages", c.RateLimit.Messages},
+		{"chats", c.RateLimit.Chats},
+		{"password_reset_emails", c.RateLimit.PasswordResetEmails},
+	}
+	for _, p := range policies {
+		if p.policy.Requests < 0 || (p.policy.Requests > 0 && (p.policy.Per <= 0 || p.policy.Burst < 1)) {
+			errs = append(errs, fmt.Errorf("rate_limit.%s needs a positive per and burst", p.name))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Duration is a time.Duration that reads as "15s", "24h" and so on from
+// config files and environment variables.
+type Duration time.Duration
+
+func (d Duration) Std() time.Duration {
+	return time.Duration(d)
+}
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
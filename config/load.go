@@ -0,0 +1,156 @@
+package config
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// EnvConfigPath names the config file when -config is not given.
+const EnvConfigPath = "FARA_CONFIG"
+
+// Flags are the command line overrides. Only flags that were actually set on
+// the command line override the lower layers.
+type Flags struct {
+	fs         *flag.FlagSet
+	configPath *string
+	port       *int
+	dbDriver   *string
+	dbDSN      *string
+	jwtSecret  *string
+}
+
+// RegisterFlags defines the configuration flags on fs. Call Load after fs has
+// been parsed.
+func RegisterFlags(fs *flag.FlagSet) *Flags {
+	defaults := Default()
+	return &Flags{
+		fs:         fs,
+		configPath: fs.String("config", "", "Path to a YAML or TOML config file (env "+EnvConfigPath+")"),
+		port:       fs.Int("port", defaults.Server.Port, "Port to run the HTTP server"),
+		dbDriver:   fs.String("db-driver", defaults.Database.Driver, "Database backend: mysql or sqlite"),
+		dbDSN:      fs.String("db-dsn", "", "Database DSN; a file path for sqlite"),
+		jwtSecret:  fs.String("jwt-secret", "", "Shared secret for HS256 access tokens"),
+	}
+}
+
+// Load builds the configuration from defaults, the config file, the
+// environment and the parsed flags, in that order, and validates the result.
+func (f *Flags) Load() (Config, error) {
+	config := Default()
+
+	path := *f.configPath
+	if path == "" {
+		path = os.Getenv(EnvConfigPath)
+	}
+	if path != "" {
+		if err := loadFile(path, &config); err != nil {
+			return Config{}, err
+		}
+	}
+
+	if err := loadEnv(&config); err != nil {
+		return Config{}, err
+	}
+
+	f.fs.Visit(func(fl *flag.Flag) {
+		switch fl.Name {
+		case "port":
+			config.Server.Port = *f.port
+		case "db-driver":
+			config.Database.Driver = *f.dbDriver
+		case "db-dsn":
+			config.Database.DSN = *f.dbDSN
+		case "jwt-secret":
+			config.Auth.JWTSecret = *f.jwtSecret
+		}
+	})
+
+	if err := config.Validate(); err != nil {
+		return Config{}, fmt.Errorf("invalid configuration: %w", err)
+	}
+	return config, nil
+}
+
+func loadFile(path string, config *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	switch filepath.Ext(path) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		err = decoder.Decode(config)
+	case ".toml":
+		err = toml.NewDecoder(bytes.NewReader(data)).DisallowUnknownFields().Decode(config)
+	default:
+		return fmt.Errorf("unsupported config file type %q, use .yaml, .yml or .toml", filepath.Ext(path))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// loadEnv overrides every field carrying an env tag whose variable is set.
+func loadEnv(config *Config) error {
+	return walkEnv(reflect.ValueOf(config).Elem())
+}
+
+func walkEnv(v reflect.Value) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := v.Field(i)
+		if field.Kind() == reflect.Struct {
+			if err := walkEnv(field); err != nil {
+				return err
+			}
+			continue
+		}
+		name := t.Field(i).Tag.Get("env")
+		if name == "" {
+			continue
+		}
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		if err := setField(field, value); err != nil {
+			return fmt.Errorf("invalid value for %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func setField(field reflect.Value, value string) error {
+	if unmarshaler, ok := field.Addr().Interface().(interface{ UnmarshalText([]byte) error }); ok {
+		return unmarshaler.UnmarshalText([]byte(value))
+	}
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Int, reflect.Int64:
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		field.SetInt(parsed)
+	case reflect.Bool:
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(parsed)
+	default:
+		return fmt.Errorf("unsupported field kind %s", field.Kind())
+	}
+	return nil
+}
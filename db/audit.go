@@ -0,0 +1,10 @@
+package db
+
+import "fmt"
+
+func (d *Database) CreateAuditEntry(entry AuditEntry) error {
+	if err := d.db.Create(&entry).Error; err != nil {
+		return fmt.Errorf("failed to create audit entry: %w", err)
+	}
+	return nil
+}
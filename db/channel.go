@@ -0,0 +1,98 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rs/xid"
+	"gorm.io/gorm"
+)
+
+// NewChannel creates a channel owned by ownerID. Without a handle it is
+// private and only reachable through invite links.
+func (d *Database) NewChannel(name string, handle string, ownerID string) (string, error) {
+	chatTable := ConvertChatToChatTable(Chat{
+		Name:        name,
+		Type:        Channel,
+		CreatedTime: time.Now(),
+	})
+	chatTable.ID = hashDB(xid.New().String())
+	if handle != "" {
+		chatTable.Handle = sql.NullString{String: strings.ToLower(handle), Valid: true}
+	}
+	err := d.db.Transaction(func(tx *gorm.DB) error {
+		if chatTable.Handle.Valid {
+			var taken int64
+			if err := tx.Model(&ChatTable{}).Where("handle = ?", chatTable.Handle.String).Count(&taken).Error; err != nil {
+				return err
+			}
+			if taken > 0 {
+				return conflict("handle is already taken", nil)
+			}
+		}
+		if err := tx.Create(&chatTable).Error; err != nil {
+			return err
+		}
+		return tx.Create(&ChatMember{
+			UserTableID: ownerID,
+			ChatTableID: chatTable.ID,
+			Role:        RoleOwner,
+			JoinedTime:  time.Now(),
+		}).Error
+	})
+	if err != nil {
+		return "", wrapError("create channel", err)
+	}
+	return chatTable.ID, nil
+}
+
+// GetChat returns the chat with the given ID.
+func (d *Database) GetChat(chatID string) (ChatTable, error) {
+	var chat ChatTable
+	if err := d.db.Where("id = ?", chatID).First(&chat).Error; err != nil {
+		return chat, lookupError("chat", err)
+	}
+	return chat, nil
+}
+
+func (d *Database) publicChannels() *gorm.DB {
+	return d.db.Model(&ChatTable{}).
+		Select("chat_tables.*, COUNT(chat_members.user_table_id) AS subscribers").
+		Joins("LEFT JOIN chat_members ON chat_members.chat_table_id = chat_tables.id AND chat_members.left_time IS NULL").
+		Where("chat_tables.type = ? AND chat_tables.handle IS NOT NULL", Channel.Int()).
+		Group("chat_tables.id")
+}
+
+// GetChannelByHandle returns the public channel with the given handle.
+func (d *Database) GetChannelByHandle(handle string) (ChannelListing, error) {
+	var channels []ChannelListing
+	if err := d.publicChannels().Where("chat_tables.handle = ?", strings.ToLower(handle)).Scan(&channels).Error; err != nil {
+		return ChannelListing{}, lookupError("channel", err)
+	}
+	if len(channels) == 0 {
+		return ChannelListing{}, notFound("channel", nil)
+	}
+	return channels[0], nil
+}
+
+// SearchChannels returns up to limit public channels whose handle or name
+// contains query, the ones with the most subscribers first. An empty query
+// matches every public channel.
+func (d *Database) SearchChannels(query string, limit int) ([]ChannelListing, error) {
+	search := d.publicChannels()
+	if query != "" {
+		pattern := "%" + likeEscaper.Replace(strings.ToLower(query)) + "%"
+		search = search.Where("chat_tables.handle LIKE ? ESCAPE '!' OR LOWER(chat_tables.name) LIKE ? ESCAPE '!'", pattern, pattern)
+	}
+	channels := []ChannelListing{}
+	if err := search.Order("subscribers DESC").Order("chat_tables.handle").Limit(limit).Scan(&channels).Error; err != nil {
+		return nil, fmt.Errorf("failed to search channels: %w", err)
+	}
+	return channels, nil
+}
+
+// likeEscaper escapes the wildcards of a LIKE pattern, with ! as the escape
+// character since MySQL and SQLite disagree on a default one.
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
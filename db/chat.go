@@ -10,7 +10,9 @@ import (
 	"gorm.io/gorm"
 )
 
-func (d *Database) NewChat(chatName string, chatType ChatType, userTable []UserTable) (string, error) {
+// NewChat creates a chat of the users. In a group, ownerID becomes the
+// owner; direct chats have none.
+func (d *Database) NewChat(chatName string, chatType ChatType, userTable []UserTable, ownerID string) (string, error) {
 	name := chatName
 	if chatName == "" {
 		for _, user := range userTable {
@@ -28,7 +30,7 @@ func (d *Database) NewChat(chatName string, chatType ChatType, userTable []UserT
 	chatTable := ConvertChatToChatTable(chat)
 	if chatType == Direct {
 
-		directChatID, err := Mysql.CheckRepeatedDirectChat(userTable)
+		directChatID, err := d.CheckRepeatedDirectChat(userTable)
 		if err != nil {
 			return "", fmt.Errorf("error checking for repeated chat: %v", err)
 
@@ -43,9 +45,11 @@ func (d *Database) NewChat(chatName string, chatType ChatType, userTable []UserT
 			return "", fmt.Errorf("error generating chat id for chat: %v", err)
 		}
 		chatTable.ID = chatID
-		d.db.Create(&chatTable)
-		if err := d.generateChatMemberForChat(userTable, chatTable); err != nil {
-			return "", fmt.Errorf("error generating chat member for chat : %v", err)
+		if err := d.db.Create(&chatTable).Error; err != nil {
+			return "", fmt.Errorf("error creating chat: %w", err)
+		}
+		if err := d.generateChatMemberForChat(userTable, chatTable, ""); err != nil {
+			return "", fmt.Errorf("error generating chat member for chat : %w", err)
 		}
 
 	}
@@ -53,44 +57,201 @@ func (d *Database) NewChat(chatName string, chatType ChatType, userTable []UserT
 		guid := xid.New()
 		chatID = hashDB(guid.String())
 		chatTable.ID = chatID
-		d.db.Create(&chatTable)
-		if err := d.generateChatMemberForChat(userTable, chatTable); err != nil {
-			return "", fmt.Errorf("error generating chat member for chat : %v", err)
+		if err := d.db.Create(&chatTable).Error; err != nil {
+			return "", fmt.Errorf("error creating chat: %w", err)
+		}
+		if err := d.generateChatMemberForChat(userTable, chatTable, ownerID); err != nil {
+			return "", fmt.Errorf("error generating chat member for chat : %w", err)
 		}
 	}
 
 	return chatID, nil
 }
 
-func (d *Database) GetChatMessages(ChatID string) ([]Message, error) {
+// GetChatMessages returns one page of the chat's messages, newest first.
+// With cursor.After set it returns the messages right after that ID, with
+// cursor.Before set the ones right before it, and with neither the latest.
+func (d *Database) GetChatMessages(ChatID string, cursor MessageCursor) (MessagePage, error) {
 	var messages []Message
-	if err := d.db.Preload("UserTable").Preload("ChatTable").Where("chat_table_id = ?", ChatID).Find(&messages).Error; err != nil {
-		return nil, fmt.Errorf("no  message found for chat %w", err)
+	query := d.db.Unscoped().Preload("UserTable").Where("chat_table_id = ?", ChatID).Limit(cursor.Limit + 1)
+	if cursor.After > 0 {
+		query = query.Where("id > ?", cursor.After).Order("id ASC")
+	} else {
+		if cursor.Before > 0 {
+			query = query.Where("id < ?", cursor.Before)
+		}
+		query = query.Order("id DESC")
+	}
+	if err := query.Find(&messages).Error; err != nil {
+		return MessagePage{}, fmt.Errorf("no  message found for chat %w", err)
+	}
+
+	page := MessagePage{}
+	more := len(messages) > cursor.Limit
+	if more {
+		messages = messages[:cursor.Limit]
+	}
+	if cursor.After > 0 {
+		for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+			messages[i], messages[j] = messages[j], messages[i]
+		}
+		page.HasNewer = more
+	} else {
+		page.HasOlder = more
+	}
+	page.Messages = messages
+	if len(messages) == 0 {
+		return page, nil
+	}
+
+	var err error
+	if cursor.After > 0 {
+		page.HasOlder, err = d.chatHasMessage(ChatID, "id < ?", messages[len(messages)-1].ID)
+	} else {
+		page.HasNewer, err = d.chatHasMessage(ChatID, "id > ?", messages[0].ID)
+	}
+	if err != nil {
+		return MessagePage{}, err
+	}
+	return page, nil
+}
+
+func (d *Database) chatHasMessage(chatID string, condition string, messageID int) (bool, error) {
+	var ids []int
+	if err := d.db.Unscoped().Model(&Message{}).Where("chat_table_id = ?", chatID).Where(condition, messageID).Limit(1).Pluck("id", &ids).Error; err != nil {
+		return false, fmt.Errorf("failed to look for more messages: %w", err)
 	}
-	return messages, nil
+	return len(ids) > 0, nil
 }
 
 func (d *Database) GetUsersChatMembers(userID string) ([]ChatMember, error) {
 	var userChatMembers []ChatMember
-	if err := d.db.Preload("UserTable").Preload("ChatTable").Where("user_table_id = ?", userID).Find(&userChatMembers).Error; err != nil {
+	if err := d.db.Preload("UserTable").Preload("ChatTable").Where("user_table_id = ? AND left_time IS NULL", userID).Find(&userChatMembers).Error; err != nil {
 		return nil, fmt.Errorf("no  chat found for user %w", err)
 	}
 	return userChatMembers, nil
 }
 
+// GetChatMembers returns the users currently in the chat, without the ones
+// who have left.
+func (d *Database) GetChatMembers(chatID string) ([]ChatMember, error) {
+	var chatMembers []ChatMember
+	if err := d.db.Preload("UserTable").Where("chat_table_id = ? AND left_time IS NULL", chatID).Order("joined_time").Find(&chatMembers).Error; err != nil {
+		return nil, fmt.Errorf("failed to get chat members: %w", err)
+	}
+	return chatMembers, nil
+}
+
+// GetChatMember returns userID's membership of the chat, with the chat.
+// Users who have left the chat are not members; for them, as for strangers,
+// it returns an ErrNotFound.
+func (d *Database) GetChatMember(chatID string, userID string) (ChatMember, error) {
+	var chatMember ChatMember
+	if err := d.db.Preload("ChatTable").Where("chat_table_id = ? AND user_table_id = ? AND left_time IS NULL", chatID, userID).First(&chatMember).Error; err != nil {
+		return chatMember, lookupError("chat member", err)
+	}
+	return chatMember, nil
+}
+
+// AddChatMember makes userID a plain member of the chat. Users who left
+// before rejoin with a new JoinedTime.
+func (d *Database) AddChatMember(chatID string, userID string) error {
+	err := d.db.Transaction(func(tx *gorm.DB) error {
+		return addChatMember(tx, chatID, userID)
+	})
+	if err != nil {
+		return wrapError("add chat member", err)
+	}
+	return nil
+}
+
+func addChatMember(tx *gorm.DB, chatID string, userID string) error {
+	var rows []ChatMember
+	if err := tx.Where("chat_table_id = ? AND user_table_id = ?", chatID, userID).Find(&rows).Error; err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if !row.LeftTime.Valid {
+			return conflict("already a member of this chat", nil)
+		}
+	}
+	if len(rows) > 0 {
+		return tx.Model(&ChatMember{}).Where("chat_table_id = ? AND user_table_id = ?", chatID, userID).Updates(map[string]any{
+			"role":        RoleMember,
+			"joined_time": time.Now(),
+			"left_time":   nil,
+		}).Error
+	}
+	return tx.Create(&ChatMember{
+		UserTableID: userID,
+		ChatTableID: chatID,
+		JoinedTime:  time.Now(),
+	}).Error
+}
+
+// RemoveChatMember ends userID's membership of the chat. Their messages
+// stay.
+func (d *Database) RemoveChatMember(chatID string, userID string) error {
+	result := d.db.Model(&ChatMember{}).Where("chat_table_id = ? AND user_table_id = ? AND left_time IS NULL", chatID, userID).Update("left_time", time.Now())
+	if result.Error != nil {
+		return fmt.Errorf("failed to remove chat member: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return notFound("chat member", nil)
+	}
+	return nil
+}
+
+// SetChatMemberRole changes the role of a current member. Ownership moves
+// with TransferChatOwnership instead.
+func (d *Database) SetChatMemberRole(chatID string, userID string, role ChatRole) error {
+	result := d.db.Model(&ChatMember{}).Where("chat_table_id = ? AND user_table_id = ? AND left_time IS NULL", chatID, userID).Update("role", role)
+	if result.Error != nil {
+		return fmt.Errorf("failed to change chat member role: %w", result.Error)
+	}
+	return nil
+}
+
+// TransferChatOwnership makes toUserID the owner of the chat and the
+// previous owner, fromUserID, an admin.
+func (d *Database) TransferChatOwnership(chatID string, fromUserID string, toUserID string) error {
+	err := d.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&ChatMember{}).Where("chat_table_id = ? AND user_table_id = ? AND left_time IS NULL", chatID, fromUserID).Update("role", RoleAdmin).Error; err != nil {
+			return err
+		}
+		result := tx.Model(&ChatMember{}).Where("chat_table_id = ? AND user_table_id = ? AND left_time IS NULL", chatID, toUserID).Update("role", RoleOwner)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return notFound("chat member", nil)
+		}
+		return nil
+	})
+	if err != nil {
+		return wrapError("transfer chat ownership", err)
+	}
+	return nil
+}
+
+// RenameChat sets the chat's name.
+func (d *Database) RenameChat(chatID string, name string) error {
+	if err := d.db.Model(&ChatTable{}).Where("id = ?", chatID).Update("name", name).Error; err != nil {
+		return fmt.Errorf("failed to rename chat: %w", err)
+	}
+	return nil
+}
+
 // func (d *Database) GetUsersChatTables(userChatMembers string) ([]ChatMember, error) {
 
 func (d *Database) GetUsersChatIDAndChatName(chatMember []ChatMember) ([]ChatIDAndChatName, error) {
-	var result []ChatIDAndChatName
+	result := []ChatIDAndChatName{}
 	for _, chat := range chatMember {
 		result = append(result, ChatIDAndChatName{
 			ChatID:   chat.ChatTableID,
 			ChatName: chat.ChatTable.Name,
 		})
 	}
-	if len(result) == 0 {
-		return result, errors.New("no chat found for user ")
-	}
 	return result, nil
 }
 
@@ -117,7 +278,7 @@ func (d *Database) CheckRepeatedDirectChat(userTable []UserTable) (string, error
 }
 func generateChatIDForDirectChat(userTable []UserTable) (string, error) {
 	if len(userTable) != 2 {
-		return "", errors.New("wrong number of users")
+		return "", invalid("a direct chat needs exactly two users")
 	}
 	firstXID, err := xid.FromString(userTable[0].ID)
 	if err != nil {
@@ -138,7 +299,7 @@ func generateChatIDForDirectChat(userTable []UserTable) (string, error) {
 		smallID = userTable[0].ID
 		bigID = userTable[1].ID
 	} else {
-		return "", errors.New("two ids are the same")
+		return "", invalid("cannot start a direct chat with yourself")
 	}
 	chatID := smallID + bigID
 	hashedChatID := hashDB(chatID)
@@ -146,7 +307,7 @@ func generateChatIDForDirectChat(userTable []UserTable) (string, error) {
 
 }
 
-func (d *Database) generateChatMemberForChat(userTable []UserTable, chatTable ChatTable) error {
+func (d *Database) generateChatMemberForChat(userTable []UserTable, chatTable ChatTable, ownerID string) error {
 	var chatMembers []ChatMember
 	for _, u := range userTable {
 
@@ -157,6 +318,9 @@ func (d *Database) generateChatMemberForChat(userTable []UserTable, chatTable Ch
 			ChatTableID: chatTable.ID,
 			UserTableID: u.ID,
 		}
+		if u.ID == ownerID {
+			chatMember.Role = RoleOwner
+		}
 		chatMembers = append(chatMembers, chatMember)
 
 	}
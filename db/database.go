@@ -3,30 +3,69 @@ package db
 import (
 	"fmt"
 	"log"
+	"time"
 
+	"github.com/glebarez/sqlite"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
 )
 
-var Mysql Database
+const (
+	DriverMySQL  = "mysql"
+	DriverSQLite = "sqlite"
+)
+
+// Config selects the database backend. For sqlite the DSN is a file path (or
+// ":memory:"), for mysql it is a go-sql-driver DSN.
+type Config struct {
+	Driver          string
+	DSN             string
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+}
 
 type Database struct {
-	db *gorm.DB
+	db     *gorm.DB
+	driver string
 }
 
-func NewDatabase() {
-	log.Println("Database created")
-	var err error
-	dsn := "root:831374@tcp(127.0.0.1:3306)/messenger?charset=utf8mb4&parseTime=True&loc=Local"
-	gormDB, err := gorm.Open(mysql.Open(dsn), &gorm.Config{})
-	Mysql.db = gormDB
+func NewDatabase(config Config) (*Database, error) {
+	dialector, err := openDialector(config)
+	if err != nil {
+		return nil, err
+	}
+	gormDB, err := gorm.Open(dialector, &gorm.Config{})
 	if err != nil {
-		panic("failed to connect to database")
+		return nil, fmt.Errorf("failed to connect to %s database: %w", config.Driver, err)
 	}
-	err = Mysql.db.AutoMigrate(&ChatTable{}, &ChatMember{}, &Message{}, &UserTable{}, &ContactTable{})
+	sqlDB, err := gormDB.DB()
 	if err != nil {
-		log.Printf("failed to migrate: %v", err)
-		return
+		return nil, fmt.Errorf("failed to get connection pool: %w", err)
+	}
+	sqlDB.SetMaxOpenConns(config.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(config.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(config.ConnMaxLifetime)
+	if config.Driver == DriverSQLite {
+		// sqlite allows a single writer; funnelling everything through one
+		// connection avoids "database is locked" errors and keeps an
+		// in-memory database from being split across connections or
+		// dropped with a recycled one.
+		sqlDB.SetMaxOpenConns(1)
+		sqlDB.SetMaxIdleConns(1)
+		sqlDB.SetConnMaxLifetime(0)
+	}
+	log.Printf("Database created (%s)", config.Driver)
+	return &Database{db: gormDB, driver: config.Driver}, nil
+}
+
+func openDialector(config Config) (gorm.Dialector, error) {
+	switch config.Driver {
+	case DriverMySQL:
+		return mysql.Open(config.DSN), nil
+	case DriverSQLite:
+		return sqlite.Open(config.DSN), nil
+	default:
+		return nil, fmt.Errorf("unknown database driver %q", config.Driver)
 	}
-	fmt.Println("Migration done ..")
 }
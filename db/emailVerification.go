@@ -0,0 +1,65 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrInvalidVerificationToken covers unknown, used and expired verification
+// tokens alike.
+var ErrInvalidVerificationToken error = &Error{Kind: ErrInvalid, Message: "invalid or expired verification token"}
+
+func (d *Database) CreateEmailVerificationToken(token EmailVerificationToken) error {
+	if err := d.db.Create(&token).Error; err != nil {
+		return fmt.Errorf("failed to create email verification token: %w", err)
+	}
+	return nil
+}
+
+// VerifyEmail uses up the verification token with the given hash and marks
+// the address it was sent to as verified, provided the user still has that
+// address. It returns the user's ID.
+func (d *Database) VerifyEmail(tokenHash string) (string, error) {
+	var userID string
+	err := d.db.Transaction(func(tx *gorm.DB) error {
+		var token EmailVerificationToken
+		err := tx.Where("id = ? AND used_time IS NULL AND expires_time > ?", tokenHash, time.Now()).First(&token).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidVerificationToken
+		}
+		if err != nil {
+			return err
+		}
+		var count int64
+		if err := tx.Model(&UserTable{}).Where("id = ? AND email = ?", token.UserTableID, token.Email).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return invalid("the account no longer uses this email address")
+		}
+		now := time.Now()
+		result := tx.Model(&EmailVerificationToken{}).Where("id = ? AND used_time IS NULL", tokenHash).Update("used_time", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			// Used concurrently since we read it.
+			return ErrInvalidVerificationToken
+		}
+		err = tx.Model(&UserTable{}).
+			Where("id = ? AND email = ? AND email_verified_time IS NULL", token.UserTableID, token.Email).
+			Update("email_verified_time", now).Error
+		if err != nil {
+			return err
+		}
+		userID = token.UserTableID
+		return nil
+	})
+	if err != nil {
+		return "", wrapError("verify email", err)
+	}
+	return userID, nil
+}
@@ -0,0 +1,69 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// Kinds of Error. Test for them with errors.Is.
+var (
+	ErrNotFound = errors.New("not found")
+	ErrConflict = errors.New("conflict")
+	ErrInvalid  = errors.New("invalid")
+)
+
+// Error is a failure the caller can act on, as opposed to the database being
+// unavailable. Kind is ErrNotFound, ErrConflict or ErrInvalid, Message says
+// what went wrong in words fit for the client and Err is the cause, if any.
+type Error struct {
+	Kind    error
+	Message string
+	Err     error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() []error {
+	if e.Err != nil {
+		return []error{e.Kind, e.Err}
+	}
+	return []error{e.Kind}
+}
+
+func notFound(what string, err error) error {
+	return &Error{Kind: ErrNotFound, Message: what + " not found", Err: err}
+}
+
+func conflict(message string, err error) error {
+	return &Error{Kind: ErrConflict, Message: message, Err: err}
+}
+
+func invalid(message string) error {
+	return &Error{Kind: ErrInvalid, Message: message}
+}
+
+// lookupError wraps an error from looking up what, turning
+// gorm.ErrRecordNotFound into ErrNotFound.
+func lookupError(what string, err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return notFound(what, err)
+	}
+	return fmt.Errorf("failed to get %s: %w", what, err)
+}
+
+// wrapError wraps an error from failing to do what. An *Error is passed on
+// as it is, its message being meant for the client.
+func wrapError(what string, err error) error {
+	var dbErr *Error
+	if errors.As(err, &dbErr) {
+		return err
+	}
+	return fmt.Errorf("failed to %s: %w", what, err)
+}
@@ -0,0 +1,140 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrInvalidInvite covers unknown, revoked, expired and used up invites
+// alike.
+var ErrInvalidInvite error = &Error{Kind: ErrNotFound, Message: "invalid or expired invite link"}
+
+// activeInvites narrows query to invites that can still be used at now.
+func activeInvites(query *gorm.DB, now time.Time) *gorm.DB {
+	return query.Where("revoked_time IS NULL AND (expires_time IS NULL OR expires_time > ?) AND (max_uses = 0 OR uses < max_uses)", now)
+}
+
+func (d *Database) CreateChatInvite(invite ChatInvite) error {
+	if err := d.db.Create(&invite).Error; err != nil {
+		return fmt.Errorf("failed to create chat invite: %w", err)
+	}
+	return nil
+}
+
+// GetActiveChatInvites returns the chat's invites that still work, oldest
+// first.
+func (d *Database) GetActiveChatInvites(chatID string) ([]ChatInvite, error) {
+	var invites []ChatInvite
+	if err := activeInvites(d.db, time.Now()).Where("chat_table_id = ?", chatID).Order("created_time").Find(&invites).Error; err != nil {
+		return nil, fmt.Errorf("failed to get chat invites: %w", err)
+	}
+	return invites, nil
+}
+
+func (d *Database) RevokeChatInvite(chatID string, inviteID string) error {
+	result := d.db.Model(&ChatInvite{}).Where("id = ? AND chat_table_id = ? AND revoked_time IS NULL", inviteID, chatID).Update("revoked_time", time.Now())
+	if result.Error != nil {
+		return fmt.Errorf("failed to revoke chat invite: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return notFound("invite", nil)
+	}
+	return nil
+}
+
+// JoinChat uses the invite with the given token hash for userID. The user
+// becomes a member right away or, if the invite requires approval, gets a
+// join request. Either way it counts as a use. It returns the invite.
+func (d *Database) JoinChat(tokenHash string, userID string) (ChatInvite, error) {
+	var invite ChatInvite
+	err := d.db.Transaction(func(tx *gorm.DB) error {
+		err := activeInvites(tx, time.Now()).Where("token_hash = ?", tokenHash).First(&invite).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidInvite
+		}
+		if err != nil {
+			return err
+		}
+		result := tx.Model(&ChatInvite{}).Where("id = ? AND (max_uses = 0 OR uses < max_uses)", invite.ID).Update("uses", gorm.Expr("uses + 1"))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			// Used up concurrently since we read it.
+			return ErrInvalidInvite
+		}
+		if !invite.RequiresApproval {
+			return addChatMember(tx, invite.ChatTableID, userID)
+		}
+
+		var members int64
+		if err := tx.Model(&ChatMember{}).Where("chat_table_id = ? AND user_table_id = ? AND left_time IS NULL", invite.ChatTableID, userID).Count(&members).Error; err != nil {
+			return err
+		}
+		if members > 0 {
+			return conflict("already a member of this chat", nil)
+		}
+		var requests int64
+		if err := tx.Model(&ChatJoinRequest{}).Where("chat_table_id = ? AND user_table_id = ?", invite.ChatTableID, userID).Count(&requests).Error; err != nil {
+			return err
+		}
+		if requests > 0 {
+			return conflict("you already asked to join this chat", nil)
+		}
+		return tx.Create(&ChatJoinRequest{
+			ChatTableID:  invite.ChatTableID,
+			UserTableID:  userID,
+			ChatInviteID: invite.ID,
+			CreatedTime:  time.Now(),
+		}).Error
+	})
+	if err != nil {
+		return ChatInvite{}, wrapError("join chat", err)
+	}
+	return invite, nil
+}
+
+// GetChatJoinRequests returns the pending join requests of the chat with
+// their users, oldest first.
+func (d *Database) GetChatJoinRequests(chatID string) ([]ChatJoinRequest, error) {
+	var requests []ChatJoinRequest
+	if err := d.db.Preload("UserTable").Where("chat_table_id = ?", chatID).Order("created_time").Find(&requests).Error; err != nil {
+		return nil, fmt.Errorf("failed to get join requests: %w", err)
+	}
+	return requests, nil
+}
+
+// ApproveChatJoinRequest makes the user who asked to join a member.
+func (d *Database) ApproveChatJoinRequest(chatID string, userID string) error {
+	err := d.db.Transaction(func(tx *gorm.DB) error {
+		if err := deleteChatJoinRequest(tx, chatID, userID); err != nil {
+			return err
+		}
+		return addChatMember(tx, chatID, userID)
+	})
+	if err != nil {
+		return wrapError("approve join request", err)
+	}
+	return nil
+}
+
+func (d *Database) RejectChatJoinRequest(chatID string, userID string) error {
+	if err := deleteChatJoinRequest(d.db, chatID, userID); err != nil {
+		return wrapError("reject join request", err)
+	}
+	return nil
+}
+
+func deleteChatJoinRequest(tx *gorm.DB, chatID string, userID string) error {
+	result := tx.Where("chat_table_id = ? AND user_table_id = ?", chatID, userID).Delete(&ChatJoinRequest{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return notFound("join request", nil)
+	}
+	return nil
+}
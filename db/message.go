@@ -1,17 +1,42 @@
 package db
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"time"
 
-func (d *Database) SendMessage(senderID string, chatID string, content string) error {
-	var message Message
-	message.UserTableID = senderID
-	message.ChatTableID = chatID
-	message.Content = content
+	"gorm.io/gorm"
+)
+
+func (d *Database) SendMessage(senderID string, chatID string, content string) (Message, error) {
+	return d.createMessage(Message{
+		UserTableID: senderID,
+		ChatTableID: chatID,
+		Type:        TextMessage,
+		Content:     content,
+	})
+}
+
+// SendSystemMessage records a change actorID made to the chat.
+func (d *Database) SendSystemMessage(actorID string, chatID string, content string) (Message, error) {
+	return d.createMessage(Message{
+		UserTableID: actorID,
+		ChatTableID: chatID,
+		Type:        SystemMessage,
+		Content:     content,
+	})
+}
+
+func (d *Database) createMessage(message Message) (Message, error) {
+	message.CreatedTime = time.Now()
 	result := d.db.Create(&message)
 	if result.Error != nil {
-		return fmt.Errorf("error sending message: %w", result.Error)
+		return Message{}, fmt.Errorf("error sending message: %w", result.Error)
 	}
-	return nil
+	if err := d.db.Preload("UserTable").First(&message, message.ID).Error; err != nil {
+		return Message{}, fmt.Errorf("error reading sent message: %w", err)
+	}
+	return message, nil
 }
 
 func (d *Database) DeleteMessage(message Message) error {
@@ -24,8 +49,57 @@ func (d *Database) DeleteMessage(message Message) error {
 
 func (d *Database) GetUserMessage(messageID int, userID string) (Message, error) {
 	var message Message
-	if err := d.db.Preload("UserTable").Preload("chat_tables").Where("ID=?", messageID).Where("user_table_id = ?", userID).First(&message).Error; err != nil {
-		return message, err
+	if err := d.db.Preload("UserTable").Preload("ChatTable").Where("ID=?", messageID).Where("user_table_id = ? AND type = ?", userID, TextMessage).First(&message).Error; err != nil {
+		return message, lookupError("message", err)
 	}
 	return message, nil
 }
+
+// GetMessage returns a message that has not been deleted, with its sender.
+func (d *Database) GetMessage(messageID int) (Message, error) {
+	var message Message
+	if err := d.db.Preload("UserTable").Where("id = ?", messageID).First(&message).Error; err != nil {
+		return message, lookupError("message", err)
+	}
+	return message, nil
+}
+
+// EditMessage replaces the content of userID's message, keeping the old
+// content as a revision.
+func (d *Database) EditMessage(messageID int, userID string, content string) (Message, error) {
+	var message Message
+	err := d.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("id = ? AND user_table_id = ? AND type = ?", messageID, userID, TextMessage).First(&message).Error; err != nil {
+			return err
+		}
+		now := time.Now()
+		revision := MessageRevision{
+			MessageID:   message.ID,
+			Content:     message.Content,
+			CreatedTime: now,
+		}
+		if err := tx.Create(&revision).Error; err != nil {
+			return err
+		}
+		return tx.Model(&message).Updates(map[string]interface{}{
+			"content":     content,
+			"edited_time": now,
+		}).Error
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return Message{}, notFound("message", err)
+		}
+		return Message{}, fmt.Errorf("error editing message: %w", err)
+	}
+	return d.GetMessage(messageID)
+}
+
+// GetMessageRevisions returns the earlier contents of a message, oldest first.
+func (d *Database) GetMessageRevisions(messageID int) ([]MessageRevision, error) {
+	var revisions []MessageRevision
+	if err := d.db.Where("message_id = ?", messageID).Order("id").Find(&revisions).Error; err != nil {
+		return nil, fmt.Errorf("failed to get message revisions: %w", err)
+	}
+	return revisions, nil
+}
@@ -0,0 +1,282 @@
+package db
+
+import (
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Migrations live in db/migrations as NNNN_name.up.sql / NNNN_name.down.sql.
+// A file named NNNN_name.up.<driver>.sql replaces the portable one for that
+// driver, for the few statements MySQL and SQLite disagree on.
+//
+// Each migration runs in a transaction, but MySQL commits every DDL statement
+// on its own, so only SQLite gets a failed migration rolled back. For MySQL a
+// script therefore holds a single statement, or only statements that can run
+// again, such as CREATE TABLE IF NOT EXISTS; a migration that failed halfway
+// can then simply be retried.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+var migrationFileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)(?:\.(\w+))?\.sql$`)
+
+type Migration struct {
+	Version  int
+	Name     string
+	Up       string
+	Down     string
+	Checksum string
+}
+
+type MigrationStatus struct {
+	Migration
+	Applied     bool
+	AppliedTime time.Time
+	// Modified is set when an applied migration no longer matches the
+	// checksum recorded when it ran.
+	Modified bool
+}
+
+// schemaVersion is one row of the schema_version table.
+type schemaVersion struct {
+	Version     int
+	Name        string
+	Checksum    string
+	AppliedTime time.Time
+}
+
+func (schemaVersion) TableName() string {
+	return "schema_version"
+}
+
+const createSchemaVersionTable = `CREATE TABLE IF NOT EXISTS schema_version (
+  version bigint NOT NULL,
+  name varchar(255),
+  checksum varchar(64),
+  applied_time datetime,
+  PRIMARY KEY (version)
+)`
+
+var ErrPendingMigrations = errors.New("database schema is out of date, run `migrate up`")
+
+// loadMigrations reads the embedded migrations for driver, ordered by version.
+func loadMigrations(driver string) ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+	byVersion := map[int]*Migration{}
+	overridden := map[string]bool{}
+	for _, entry := range entries {
+		match := migrationFileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("unexpected file in migrations: %s", entry.Name())
+		}
+		version, _ := strconv.Atoi(match[1])
+		name, direction, fileDriver := match[2], match[3], match[4]
+		if fileDriver != "" && fileDriver != driver {
+			continue
+		}
+		key := match[1] + direction
+		if fileDriver == "" && overridden[key] {
+			continue
+		}
+		content, err := migrationFiles.ReadFile("migrations/" + entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", entry.Name(), err)
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: name}
+			byVersion[version] = migration
+		}
+		if migration.Name != name {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, migration.Name, name)
+		}
+		if direction == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+		if fileDriver != "" {
+			overridden[key] = true
+		}
+	}
+
+	var migrations []Migration
+	for _, migration := range byVersion {
+		if migration.Up == "" {
+			return nil, fmt.Errorf("migration %04d_%s has no up script", migration.Version, migration.Name)
+		}
+		sum := sha256.Sum256([]byte(migration.Up))
+		migration.Checksum = hex.EncodeToString(sum[:])
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+func (d *Database) appliedMigrations() (map[int]schemaVersion, error) {
+	if err := d.db.Exec(createSchemaVersionTable).Error; err != nil {
+		return nil, fmt.Errorf("failed to create schema_version table: %w", err)
+	}
+	var rows []schemaVersion
+	if err := d.db.Order("version").Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to read schema_version: %w", err)
+	}
+	applied := make(map[int]schemaVersion, len(rows))
+	for _, row := range rows {
+		applied[row.Version] = row
+	}
+	return applied, nil
+}
+
+func (d *Database) MigrationStatus() ([]MigrationStatus, error) {
+	migrations, err := loadMigrations(d.driver)
+	if err != nil {
+		return nil, err
+	}
+	applied, err := d.appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+	var result []MigrationStatus
+	for _, migration := range migrations {
+		status := MigrationStatus{Migration: migration}
+		if row, ok := applied[migration.Version]; ok {
+			status.Applied = true
+			status.AppliedTime = row.AppliedTime
+			status.Modified = row.Checksum != migration.Checksum
+		}
+		result = append(result, status)
+	}
+	return result, nil
+}
+
+// MigrateUp applies every pending migration in order and returns the ones it
+// ran. It refuses to run if an applied migration has been edited since. The
+// transaction around each migration only protects SQLite; see above.
+func (d *Database) MigrateUp() ([]Migration, error) {
+	statuses, err := d.MigrationStatus()
+	if err != nil {
+		return nil, err
+	}
+	var ran []Migration
+	for _, status := range statuses {
+		if status.Modified {
+			return ran, fmt.Errorf("migration %04d_%s was modified after it was applied", status.Version, status.Name)
+		}
+		if status.Applied {
+			continue
+		}
+		err := d.db.Transaction(func(tx *gorm.DB) error {
+			if err := execScript(tx, status.Up); err != nil {
+				return err
+			}
+			return tx.Create(&schemaVersion{
+				Version:     status.Version,
+				Name:        status.Name,
+				Checksum:    status.Checksum,
+				AppliedTime: time.Now(),
+			}).Error
+		})
+		if err != nil {
+			return ran, fmt.Errorf("failed to apply migration %04d_%s: %w", status.Version, status.Name, err)
+		}
+		log.Printf("applied migration %04d_%s", status.Version, status.Name)
+		ran = append(ran, status.Migration)
+	}
+	return ran, nil
+}
+
+// MigrateDown rolls back the latest steps applied migrations. As with
+// MigrateUp, the transaction only protects SQLite.
+func (d *Database) MigrateDown(steps int) ([]Migration, error) {
+	statuses, err := d.MigrationStatus()
+	if err != nil {
+		return nil, err
+	}
+	var ran []Migration
+	for i := len(statuses) - 1; i >= 0 && len(ran) < steps; i-- {
+		status := statuses[i]
+		if !status.Applied {
+			continue
+		}
+		if status.Down == "" {
+			return ran, fmt.Errorf("migration %04d_%s cannot be rolled back, it has no down script", status.Version, status.Name)
+		}
+		err := d.db.Transaction(func(tx *gorm.DB) error {
+			if err := execScript(tx, status.Down); err != nil {
+				return err
+			}
+			return tx.Delete(&schemaVersion{}, "version = ?", status.Version).Error
+		})
+		if err != nil {
+			return ran, fmt.Errorf("failed to roll back migration %04d_%s: %w", status.Version, status.Name, err)
+		}
+		log.Printf("rolled back migration %04d_%s", status.Version, status.Name)
+		ran = append(ran, status.Migration)
+	}
+	return ran, nil
+}
+
+// CheckSchema returns ErrPendingMigrations unless every migration is applied.
+func (d *Database) CheckSchema() error {
+	statuses, err := d.MigrationStatus()
+	if err != nil {
+		return err
+	}
+	for _, status := range statuses {
+		if status.Modified {
+			return fmt.Errorf("migration %04d_%s was modified after it was applied", status.Version, status.Name)
+		}
+		if !status.Applied {
+			return ErrPendingMigrations
+		}
+	}
+	return nil
+}
+
+// execScript runs a migration file one statement at a time; the MySQL driver
+// does not accept several statements in one Exec.
+func execScript(tx *gorm.DB, script string) error {
+	for _, statement := range splitStatements(script) {
+		if err := tx.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func splitStatements(script string) []string {
+	var lines []string
+	for _, line := range strings.Split(script, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "--") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	var statements []string
+	for _, statement := range strings.Split(strings.Join(lines, "\n"), ";") {
+		statement = strings.TrimSpace(statement)
+		if statement != "" {
+			statements = append(statements, statement)
+		}
+	}
+	return statements
+}
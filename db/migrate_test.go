@@ -0,0 +1,73 @@
+package db
+
+import (
+	"io"
+	"log"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+func newTestDatabase(t *testing.T) *Database {
+	t.Helper()
+	d, err := NewDatabase(Config{Driver: DriverSQLite, DSN: ":memory:"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func TestMigrationsRoundTrip(t *testing.T) {
+	d := newTestDatabase(t)
+	migrations, err := loadMigrations(DriverSQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.MigrateUp(); err != nil {
+		t.Fatal(err)
+	}
+	if ran, err := d.MigrateDown(len(migrations)); err != nil {
+		t.Fatal(err)
+	} else if len(ran) != len(migrations) {
+		t.Fatalf("rolled back %d migrations, want %d", len(ran), len(migrations))
+	}
+	if _, err := d.MigrateUp(); err != nil {
+		t.Fatalf("migrating up again: %v", err)
+	}
+	if err := d.CheckSchema(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// MySQL commits each DDL statement on its own, so a migration that fails
+// halfway is only safe to retry if the statements before the failure can run
+// again.
+func TestMySQLMigrationsCanBeRetried(t *testing.T) {
+	migrations, err := loadMigrations(DriverMySQL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rerunnable := []string{"CREATE TABLE IF NOT EXISTS", "DROP TABLE IF EXISTS"}
+	for _, migration := range migrations {
+		for direction, script := range map[string]string{"up": migration.Up, "down": migration.Down} {
+			statements := splitStatements(script)
+			if len(statements) < 2 {
+				continue
+			}
+			for _, statement := range statements {
+				ok := false
+				for _, prefix := range rerunnable {
+					ok = ok || strings.HasPrefix(statement, prefix)
+				}
+				if !ok {
+					t.Errorf("%04d_%s.%s: %q cannot run again; give it a migration of its own", migration.Version, migration.Name, direction, strings.SplitN(statement, "\n", 2)[0])
+				}
+			}
+		}
+	}
+}
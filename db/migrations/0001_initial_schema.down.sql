@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS `contact_tables`;
+DROP TABLE IF EXISTS `messages`;
+DROP TABLE IF EXISTS `chat_members`;
+DROP TABLE IF EXISTS `chat_tables`;
+DROP TABLE IF EXISTS `user_tables`;
@@ -0,0 +1,50 @@
+-- Tables as AutoMigrate used to create them. IF NOT EXISTS lets databases
+-- that predate migrations adopt this as their baseline untouched.
+CREATE TABLE IF NOT EXISTS `user_tables` (
+  `id` varchar(255) NOT NULL,
+  `username` longtext,
+  `first_name` longtext,
+  `last_name` longtext,
+  `password` longtext,
+  `gender` tinyint,
+  `email` varchar(255),
+  `date_of_birth` date,
+  `created_time` datetime(3) NULL,
+  `deleted_time` datetime(3) NULL,
+  PRIMARY KEY (`id`)
+);
+
+CREATE TABLE IF NOT EXISTS `chat_tables` (
+  `id` varchar(255) NOT NULL,
+  `name` longtext,
+  `created_time` datetime(3) NULL,
+  `deleted_time` datetime(3) NULL,
+  `type` tinyint,
+  PRIMARY KEY (`id`)
+);
+
+CREATE TABLE IF NOT EXISTS `chat_members` (
+  `user_table_id` varchar(255),
+  `chat_table_id` varchar(255),
+  `joined_time` datetime(3) NULL,
+  `left_time` datetime(3) NULL,
+  CONSTRAINT `fk_chat_members_user_table` FOREIGN KEY (`user_table_id`) REFERENCES `user_tables` (`id`),
+  CONSTRAINT `fk_chat_members_chat_table` FOREIGN KEY (`chat_table_id`) REFERENCES `chat_tables` (`id`)
+);
+
+CREATE TABLE IF NOT EXISTS `messages` (
+  `id` bigint NOT NULL AUTO_INCREMENT,
+  `user_table_id` varchar(255),
+  `chat_table_id` varchar(255),
+  `content` longtext,
+  PRIMARY KEY (`id`),
+  CONSTRAINT `fk_messages_user_table` FOREIGN KEY (`user_table_id`) REFERENCES `user_tables` (`id`),
+  CONSTRAINT `fk_messages_chat_table` FOREIGN KEY (`chat_table_id`) REFERENCES `chat_tables` (`id`)
+);
+
+CREATE TABLE IF NOT EXISTS `contact_tables` (
+  `user_table_id` varchar(255),
+  `contact_id` varchar(255),
+  CONSTRAINT `fk_contact_tables_user_table` FOREIGN KEY (`user_table_id`) REFERENCES `user_tables` (`id`),
+  CONSTRAINT `fk_contact_tables_contact` FOREIGN KEY (`contact_id`) REFERENCES `user_tables` (`id`)
+);
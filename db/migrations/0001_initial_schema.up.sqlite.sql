@@ -0,0 +1,47 @@
+CREATE TABLE IF NOT EXISTS `user_tables` (
+  `id` varchar(255) NOT NULL,
+  `username` text,
+  `first_name` text,
+  `last_name` text,
+  `password` text,
+  `gender` integer,
+  `email` varchar(255),
+  `date_of_birth` date,
+  `created_time` datetime,
+  `deleted_time` datetime,
+  PRIMARY KEY (`id`)
+);
+
+CREATE TABLE IF NOT EXISTS `chat_tables` (
+  `id` varchar(255) NOT NULL,
+  `name` text,
+  `created_time` datetime,
+  `deleted_time` datetime,
+  `type` integer,
+  PRIMARY KEY (`id`)
+);
+
+CREATE TABLE IF NOT EXISTS `chat_members` (
+  `user_table_id` varchar(255),
+  `chat_table_id` varchar(255),
+  `joined_time` datetime,
+  `left_time` datetime,
+  CONSTRAINT `fk_chat_members_user_table` FOREIGN KEY (`user_table_id`) REFERENCES `user_tables` (`id`),
+  CONSTRAINT `fk_chat_members_chat_table` FOREIGN KEY (`chat_table_id`) REFERENCES `chat_tables` (`id`)
+);
+
+CREATE TABLE IF NOT EXISTS `messages` (
+  `id` integer PRIMARY KEY AUTOINCREMENT,
+  `user_table_id` varchar(255),
+  `chat_table_id` varchar(255),
+  `content` text,
+  CONSTRAINT `fk_messages_user_table` FOREIGN KEY (`user_table_id`) REFERENCES `user_tables` (`id`),
+  CONSTRAINT `fk_messages_chat_table` FOREIGN KEY (`chat_table_id`) REFERENCES `chat_tables` (`id`)
+);
+
+CREATE TABLE IF NOT EXISTS `contact_tables` (
+  `user_table_id` varchar(255),
+  `contact_id` varchar(255),
+  CONSTRAINT `fk_contact_tables_user_table` FOREIGN KEY (`user_table_id`) REFERENCES `user_tables` (`id`),
+  CONSTRAINT `fk_contact_tables_contact` FOREIGN KEY (`contact_id`) REFERENCES `user_tables` (`id`)
+);
@@ -0,0 +1 @@
+DROP INDEX `idx_messages_chat_table_id_id` ON `messages`;
@@ -0,0 +1,2 @@
+-- Keyset pagination over a chat walks this index in both directions.
+CREATE INDEX `idx_messages_chat_table_id_id` ON `messages` (`chat_table_id`, `id`);
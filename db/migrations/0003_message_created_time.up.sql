@@ -0,0 +1,3 @@
+-- Messages sent before this migration keep a NULL created_time; there is no
+-- record of when they were sent.
+ALTER TABLE `messages` ADD COLUMN `created_time` datetime(3) NULL;
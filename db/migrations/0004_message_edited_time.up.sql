@@ -0,0 +1 @@
+ALTER TABLE `messages` ADD COLUMN `edited_time` datetime(3) NULL;
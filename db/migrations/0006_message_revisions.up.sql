@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS `message_revisions` (
+  `id` bigint NOT NULL AUTO_INCREMENT,
+  `message_id` bigint NOT NULL,
+  `content` longtext,
+  `created_time` datetime(3) NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_message_revisions_message_id` (`message_id`),
+  CONSTRAINT `fk_message_revisions_message` FOREIGN KEY (`message_id`) REFERENCES `messages` (`id`)
+);
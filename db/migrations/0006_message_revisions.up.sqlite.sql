@@ -0,0 +1,8 @@
+CREATE TABLE `message_revisions` (
+  `id` integer PRIMARY KEY AUTOINCREMENT,
+  `message_id` integer NOT NULL,
+  `content` text,
+  `created_time` datetime,
+  CONSTRAINT `fk_message_revisions_message` FOREIGN KEY (`message_id`) REFERENCES `messages` (`id`)
+);
+CREATE INDEX `idx_message_revisions_message_id` ON `message_revisions` (`message_id`);
@@ -0,0 +1,26 @@
+-- A session is one login. Its refresh tokens form a rotation family: each
+-- refresh uses up the presented token and issues the next one.
+CREATE TABLE `sessions` (
+  `id` varchar(255) NOT NULL,
+  `user_table_id` varchar(255) NOT NULL,
+  `created_time` datetime,
+  `revoked_time` datetime NULL,
+  PRIMARY KEY (`id`)
+);
+CREATE INDEX `idx_sessions_user_table_id` ON `sessions` (`user_table_id`);
+
+CREATE TABLE `refresh_tokens` (
+  `id` varchar(64) NOT NULL,
+  `session_id` varchar(255) NOT NULL,
+  `created_time` datetime,
+  `expires_time` datetime,
+  `used_time` datetime NULL,
+  PRIMARY KEY (`id`)
+);
+CREATE INDEX `idx_refresh_tokens_session_id` ON `refresh_tokens` (`session_id`);
+
+CREATE TABLE `revoked_tokens` (
+  `id` varchar(255) NOT NULL,
+  `expires_time` datetime,
+  PRIMARY KEY (`id`)
+);
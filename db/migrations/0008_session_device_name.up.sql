@@ -0,0 +1,2 @@
+-- Sessions opened before this migration have no device information.
+ALTER TABLE `sessions` ADD COLUMN `device_name` varchar(255) NULL;
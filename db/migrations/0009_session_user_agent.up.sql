@@ -0,0 +1 @@
+ALTER TABLE `sessions` ADD COLUMN `user_agent` varchar(512) NULL;
@@ -0,0 +1 @@
+ALTER TABLE `sessions` ADD COLUMN `last_used_time` datetime NULL;
@@ -0,0 +1,17 @@
+-- A row with a NULL confirmed_time is an enrollment the user has not
+-- confirmed with a code yet; it does not affect login.
+CREATE TABLE IF NOT EXISTS `two_factors` (
+  `user_table_id` varchar(255) NOT NULL,
+  `secret` varchar(64) NOT NULL,
+  `created_time` datetime,
+  `confirmed_time` datetime NULL,
+  `last_used_step` bigint NOT NULL DEFAULT 0,
+  PRIMARY KEY (`user_table_id`)
+);
+
+CREATE TABLE IF NOT EXISTS `recovery_codes` (
+  `user_table_id` varchar(255) NOT NULL,
+  `code_hash` varchar(64) NOT NULL,
+  `used_time` datetime NULL,
+  PRIMARY KEY (`user_table_id`, `code_hash`)
+);
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS `password_reset_tokens` (
+  `id` varchar(64) NOT NULL,
+  `user_table_id` varchar(255) NOT NULL,
+  `created_time` datetime,
+  `expires_time` datetime,
+  `used_time` datetime NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_password_reset_tokens_user_table_id` (`user_table_id`)
+);
@@ -0,0 +1 @@
+ALTER TABLE `user_tables` DROP COLUMN `email_verified_time`;
@@ -0,0 +1 @@
+ALTER TABLE `user_tables` ADD COLUMN `email_verified_time` datetime NULL;
@@ -0,0 +1 @@
+-- Nothing to undo; rolling back 0014 drops the column.
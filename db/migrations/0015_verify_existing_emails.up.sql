@@ -0,0 +1,2 @@
+-- Accounts from before verification existed keep working as they did.
+UPDATE `user_tables` SET `email_verified_time` = `created_time`;
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS `audit_entries` (
+  `id` varchar(255) NOT NULL,
+  `event` varchar(64) NOT NULL,
+  `user_table_id` varchar(255) NULL,
+  `username` varchar(255),
+  `ip_address` varchar(64),
+  `created_time` datetime,
+  PRIMARY KEY (`id`),
+  KEY `idx_audit_entries_user_table_id` (`user_table_id`)
+);
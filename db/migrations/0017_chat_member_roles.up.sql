@@ -0,0 +1,2 @@
+-- Roles: 0 member, 1 admin, 2 owner.
+ALTER TABLE `chat_members` ADD COLUMN `role` tinyint NOT NULL DEFAULT 0;
@@ -0,0 +1,2 @@
+-- Messages: 0 text, 1 system.
+ALTER TABLE `messages` ADD COLUMN `type` tinyint NOT NULL DEFAULT 0;
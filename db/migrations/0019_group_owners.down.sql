@@ -0,0 +1 @@
+-- Nothing to undo; rolling back 0017 drops the column.
@@ -0,0 +1,12 @@
+-- Nobody recorded who created a group, so existing groups get the member
+-- who joined first as their owner.
+UPDATE `chat_members` m
+JOIN `chat_tables` c ON c.`id` = m.`chat_table_id` AND c.`type` = 1
+JOIN (
+  SELECT `chat_table_id`, MIN(`joined_time`) AS `first_joined`
+  FROM `chat_members`
+  WHERE `left_time` IS NULL
+  GROUP BY `chat_table_id`
+) f ON f.`chat_table_id` = m.`chat_table_id` AND f.`first_joined` = m.`joined_time`
+SET m.`role` = 2
+WHERE m.`left_time` IS NULL;
@@ -0,0 +1,9 @@
+-- Nobody recorded who created a group, so existing groups get the member
+-- who joined first as their owner.
+UPDATE `chat_members` SET `role` = 2
+WHERE `left_time` IS NULL
+  AND `chat_table_id` IN (SELECT `id` FROM `chat_tables` WHERE `type` = 1)
+  AND `joined_time` = (
+    SELECT MIN(f.`joined_time`) FROM `chat_members` f
+    WHERE f.`chat_table_id` = `chat_members`.`chat_table_id` AND f.`left_time` IS NULL
+  );
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS `chat_join_requests`;
+DROP TABLE IF EXISTS `chat_invites`;
@@ -0,0 +1,26 @@
+-- Invite links into groups, stored by the SHA-256 of their token. max_uses
+-- 0 means unlimited.
+CREATE TABLE IF NOT EXISTS `chat_invites` (
+  `id` varchar(255) NOT NULL,
+  `token_hash` varchar(64) NOT NULL,
+  `chat_table_id` varchar(255) NOT NULL,
+  `created_by` varchar(255) NOT NULL,
+  `created_time` datetime,
+  `expires_time` datetime NULL,
+  `max_uses` int NOT NULL DEFAULT 0,
+  `uses` int NOT NULL DEFAULT 0,
+  `requires_approval` tinyint NOT NULL DEFAULT 0,
+  `revoked_time` datetime NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_chat_invites_token_hash` (`token_hash`),
+  KEY `idx_chat_invites_chat_table_id` (`chat_table_id`)
+);
+
+-- Users who followed a link that needs an admin's approval.
+CREATE TABLE IF NOT EXISTS `chat_join_requests` (
+  `chat_table_id` varchar(255) NOT NULL,
+  `user_table_id` varchar(255) NOT NULL,
+  `chat_invite_id` varchar(255) NOT NULL,
+  `created_time` datetime,
+  PRIMARY KEY (`chat_table_id`, `user_table_id`)
+);
@@ -0,0 +1 @@
+ALTER TABLE `chat_tables` DROP COLUMN `handle`;
@@ -0,0 +1,2 @@
+-- Channels (type 2) with a handle are public.
+ALTER TABLE `chat_tables` ADD COLUMN `handle` varchar(64) NULL;
@@ -0,0 +1 @@
+DROP INDEX `idx_chat_tables_handle`;
@@ -0,0 +1,3 @@
+-- Lookups go by the lower case handle, which is unique; NULLs do not
+-- collide.
+CREATE UNIQUE INDEX `idx_chat_tables_handle` ON `chat_tables` (`handle`);
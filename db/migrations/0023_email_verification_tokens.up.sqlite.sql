@@ -0,0 +1,10 @@
+CREATE TABLE `email_verification_tokens` (
+  `id` varchar(64) NOT NULL,
+  `user_table_id` varchar(255) NOT NULL,
+  `email` varchar(255) NOT NULL,
+  `created_time` datetime,
+  `expires_time` datetime,
+  `used_time` datetime NULL,
+  PRIMARY KEY (`id`)
+);
+CREATE INDEX `idx_email_verification_tokens_user_table_id` ON `email_verification_tokens` (`user_table_id`);
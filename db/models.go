@@ -7,15 +7,181 @@ import (
 	"time"
 
 	"github.com/rs/xid"
+	"gorm.io/gorm"
 )
 
+// MessageType tells messages users wrote from the ones the server writes
+// about changes to a chat.
+type MessageType int8
+
+const (
+	TextMessage MessageType = iota
+	// SystemMessage records a change to the chat, such as a member being
+	// added. UserTableID is whoever made the change. It cannot be edited or
+	// deleted.
+	SystemMessage
+)
+
+func (t MessageType) String() string {
+	if t == SystemMessage {
+		return "system"
+	}
+	return "text"
+}
+
+// Message is soft deleted: Delete only sets DeletedTime, and regular queries
+// skip deleted messages.
 type Message struct {
 	ID          int
 	UserTableID string `gorm:"type:varchar(255)"`
 	UserTable   UserTable
 	ChatTableID string `gorm:"type:varchar(255)"`
 	ChatTable   ChatTable
+	Type        MessageType
+	Content     string
+	CreatedTime time.Time
+	EditedTime  sql.NullTime
+	DeletedTime gorm.DeletedAt
+}
+
+// MessageRevision is a message's content before an edit. CreatedTime is when
+// the edit replaced it.
+type MessageRevision struct {
+	ID          int
+	MessageID   int
 	Content     string
+	CreatedTime time.Time
+}
+
+// MessageCursor selects a page of a chat's messages by message ID. At most
+// one of Before and After is set.
+type MessageCursor struct {
+	Before int
+	After  int
+	Limit  int
+}
+
+// MessagePage holds messages newest first, deleted ones included so clients
+// can drop them from what they already show, and whether the chat has more
+// on either side of them.
+type MessagePage struct {
+	Messages []Message
+	HasOlder bool
+	HasNewer bool
+}
+
+// Session is one login of a user, i.e. one device. Revoking it invalidates
+// its refresh tokens and every access token issued for it.
+type Session struct {
+	ID           string `gorm:"type:varchar(255)"`
+	UserTableID  string `gorm:"type:varchar(255)"`
+	DeviceName   string `gorm:"type:varchar(255)"`
+	UserAgent    string `gorm:"type:varchar(512)"`
+	IPAddress    string `gorm:"column:ip_address;type:varchar(64)"`
+	CreatedTime  time.Time
+	LastUsedTime sql.NullTime
+	RevokedTime  sql.NullTime
+}
+
+// RefreshToken is stored by the SHA-256 of the token, never the token itself.
+// A token is good for one refresh; UsedTime is set when it is rotated.
+type RefreshToken struct {
+	ID          string `gorm:"type:varchar(64)"`
+	SessionID   string `gorm:"type:varchar(255)"`
+	CreatedTime time.Time
+	ExpiresTime time.Time
+	UsedTime    sql.NullTime
+}
+
+// RevokedToken is an access token that was revoked before it expired. ID is
+// the token's jti; the row is useless once ExpiresTime has passed.
+type RevokedToken struct {
+	ID          string `gorm:"type:varchar(255)"`
+	ExpiresTime time.Time
+}
+
+// PasswordResetToken is emailed to a user who forgot their password. Like
+// RefreshToken it is stored by its SHA-256 and good for one use.
+type PasswordResetToken struct {
+	ID          string `gorm:"type:varchar(64)"`
+	UserTableID string `gorm:"type:varchar(255)"`
+	CreatedTime time.Time
+	ExpiresTime time.Time
+	UsedTime    sql.NullTime
+}
+
+// EmailVerificationToken is a verification link that was mailed to Email.
+// Like PasswordResetToken, ID is the SHA-256 of the token.
+type EmailVerificationToken struct {
+	ID          string `gorm:"type:varchar(64)"`
+	UserTableID string `gorm:"type:varchar(255)"`
+	Email       string `gorm:"type:varchar(255)"`
+	CreatedTime time.Time
+	ExpiresTime time.Time
+	UsedTime    sql.NullTime
+}
+
+// TwoFactor is a user's TOTP enrollment. It is only in force once
+// ConfirmedTime is set. LastUsedStep is the time step of the last accepted
+// code, so that no code is accepted twice.
+type TwoFactor struct {
+	UserTableID   string `gorm:"primaryKey;type:varchar(255)"`
+	Secret        string `gorm:"type:varchar(64)"`
+	CreatedTime   time.Time
+	ConfirmedTime sql.NullTime
+	LastUsedStep  int64
+}
+
+// RecoveryCode is stored by the SHA-256 of the code, like RefreshToken.
+type RecoveryCode struct {
+	UserTableID string `gorm:"primaryKey;type:varchar(255)"`
+	CodeHash    string `gorm:"primaryKey;type:varchar(64)"`
+	UsedTime    sql.NullTime
+}
+
+// ChatInvite is a link into a group. Like RefreshToken it is stored by the
+// SHA-256 of its token. It stops working once revoked, expired or, when
+// MaxUses is not zero, used MaxUses times. With RequiresApproval, following
+// it only files a ChatJoinRequest.
+type ChatInvite struct {
+	ID               string `gorm:"type:varchar(255)"`
+	TokenHash        string `gorm:"type:varchar(64)"`
+	ChatTableID      string `gorm:"type:varchar(255)"`
+	CreatedBy        string `gorm:"type:varchar(255)"`
+	CreatedTime      time.Time
+	ExpiresTime      sql.NullTime
+	MaxUses          int
+	Uses             int
+	RequiresApproval bool
+	RevokedTime      sql.NullTime
+}
+
+// ChatJoinRequest is a user waiting for an admin to let them into a group.
+type ChatJoinRequest struct {
+	ChatTableID  string `gorm:"primaryKey;type:varchar(255)"`
+	UserTableID  string `gorm:"primaryKey;type:varchar(255)"`
+	UserTable    UserTable
+	ChatInviteID string `gorm:"type:varchar(255)"`
+	CreatedTime  time.Time
+}
+
+// Audit events.
+const (
+	AuditLoginSucceeded = "login.succeeded"
+	AuditLoginFailed    = "login.failed"
+	AuditLoginLocked    = "login.locked"
+)
+
+// AuditEntry records a security relevant event. UserTableID is empty when
+// the event names an account that does not exist; Username is then what the
+// client sent.
+type AuditEntry struct {
+	ID          string `gorm:"type:varchar(255)"`
+	Event       string `gorm:"type:varchar(64)"`
+	UserTableID sql.NullString
+	Username    string `gorm:"type:varchar(255)"`
+	IPAddress   string `gorm:"column:ip_address;type:varchar(64)"`
+	CreatedTime time.Time
 }
 
 type Gender struct {
@@ -51,6 +217,9 @@ type UserTable struct {
 	DateOfBirth time.Time `gorm:"type:date"`
 	CreatedTime time.Time
 	DeletedTime sql.NullTime
+	// EmailVerifiedTime is set once the user followed the verification
+	// link sent to Email, and cleared when Email changes.
+	EmailVerifiedTime sql.NullTime
 }
 
 type Chat struct {
@@ -66,16 +235,50 @@ type ChatTable struct {
 	CreatedTime time.Time
 	DeletedTime sql.NullTime
 	Type        int8
+	// Handle makes a channel public: it can be found by it and anyone may
+	// subscribe. Other chats have none.
+	Handle sql.NullString `gorm:"type:varchar(64)"`
+}
+
+// ChannelListing is a public channel with its number of subscribers, the
+// admins and the owner included.
+type ChannelListing struct {
+	ChatTable   `gorm:"embedded"`
+	Subscribers int64
 }
 type ChatMember struct {
 	UserTableID string `gorm:"type:varchar(255)"`
 	UserTable   UserTable
 	ChatTableID string `gorm:"type:varchar(255)"`
 	ChatTable   ChatTable
+	Role        ChatRole
 	JoinedTime  time.Time
 	LeftTime    sql.NullTime
 }
 
+// ChatRole is what a member may do in a group or channel. Each role may do everything
+// the ones below it may. A group has exactly one owner; in direct chats
+// everybody is a plain member.
+type ChatRole int8
+
+const (
+	RoleMember ChatRole = iota
+	RoleAdmin
+	RoleOwner
+)
+
+func (r ChatRole) String() string {
+	switch r {
+	case RoleMember:
+		return "member"
+	case RoleAdmin:
+		return "admin"
+	case RoleOwner:
+		return "owner"
+	}
+	return "unknown"
+}
+
 type ChatType struct {
 	chatType int
 }
@@ -89,8 +292,11 @@ func (c *ChatType) Int() int {
 }
 
 var (
-	Direct  = ChatType{chatType: 0}
-	Group   = ChatType{chatType: 1}
+	Direct = ChatType{chatType: 0}
+	Group  = ChatType{chatType: 1}
+	// Channel is a chat where only admins post and everybody else, the
+	// subscribers, only reads.
+	Channel = ChatType{chatType: 2}
 	Unknown = ChatType{chatType: -1}
 )
 
@@ -132,6 +338,8 @@ func ConvertChatToChatTable(chat Chat) ChatTable {
 		chatType = 0
 	case Group:
 		chatType = 1
+	case Channel:
+		chatType = 2
 	default:
 		chatType = -1
 	}
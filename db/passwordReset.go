@@ -0,0 +1,67 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrInvalidResetToken covers unknown, used and expired reset tokens alike.
+var ErrInvalidResetToken error = &Error{Kind: ErrInvalid, Message: "invalid or expired password reset token"}
+
+func (d *Database) CreatePasswordResetToken(token PasswordResetToken) error {
+	if err := d.db.Create(&token).Error; err != nil {
+		return fmt.Errorf("failed to create password reset token: %w", err)
+	}
+	return nil
+}
+
+// ResetPassword uses up the reset token with the given hash and sets the
+// password hash of its user. Every other reset token of the user is used up
+// as well and every session is revoked, since whoever held them may be the
+// reason for the reset. It returns the user's ID.
+func (d *Database) ResetPassword(tokenHash string, passwordHash string) (string, error) {
+	var userID string
+	err := d.db.Transaction(func(tx *gorm.DB) error {
+		var token PasswordResetToken
+		err := tx.Where("id = ? AND used_time IS NULL AND expires_time > ?", tokenHash, time.Now()).First(&token).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidResetToken
+		}
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		result := tx.Model(&PasswordResetToken{}).Where("id = ? AND used_time IS NULL", tokenHash).Update("used_time", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			// Used concurrently since we read it.
+			return ErrInvalidResetToken
+		}
+		err = tx.Model(&PasswordResetToken{}).
+			Where("user_table_id = ? AND used_time IS NULL", token.UserTableID).
+			Update("used_time", now).Error
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(&UserTable{}).Where("id = ?", token.UserTableID).Update("password", passwordHash).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&Session{}).Where("user_table_id = ? AND revoked_time IS NULL", token.UserTableID).Update("revoked_time", now).Error; err != nil {
+			return err
+		}
+		userID = token.UserTableID
+		return nil
+	})
+	if errors.Is(err, ErrInvalidResetToken) {
+		return "", err
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to reset password: %w", err)
+	}
+	return userID, nil
+}
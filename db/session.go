@@ -0,0 +1,156 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrRefreshTokenReused means a refresh token was presented after it had
+// already been rotated, i.e. somebody else holds a copy of it.
+var ErrRefreshTokenReused = errors.New("refresh token already used")
+
+func (d *Database) CreateSession(session Session, refreshToken RefreshToken) error {
+	err := d.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&session).Error; err != nil {
+			return err
+		}
+		return tx.Create(&refreshToken).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create session: %w", err)
+	}
+	return nil
+}
+
+func (d *Database) GetSession(ID string) (Session, error) {
+	var session Session
+	if err := d.db.Where("id = ?", ID).First(&session).Error; err != nil {
+		return session, lookupError("session", err)
+	}
+	return session, nil
+}
+
+func (d *Database) RevokeSession(ID string) error {
+	result := d.db.Model(&Session{}).Where("id = ? AND revoked_time IS NULL", ID).Update("revoked_time", time.Now())
+	if result.Error != nil {
+		return fmt.Errorf("failed to revoke session: %w", result.Error)
+	}
+	return nil
+}
+
+// GetUserSessions returns the sessions of userID that can still be used,
+// i.e. that are not revoked and hold an unused, unexpired refresh token,
+// most recently used first.
+func (d *Database) GetUserSessions(userID string) ([]Session, error) {
+	var sessions []Session
+	err := d.db.
+		Where("user_table_id = ? AND revoked_time IS NULL", userID).
+		Where("EXISTS (SELECT 1 FROM refresh_tokens WHERE refresh_tokens.session_id = sessions.id AND refresh_tokens.used_time IS NULL AND refresh_tokens.expires_time > ?)", time.Now()).
+		Order("last_used_time DESC, created_time DESC").
+		Find(&sessions).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sessions: %w", err)
+	}
+	return sessions, nil
+}
+
+// TouchSession records that the session was just used from ipAddress.
+func (d *Database) TouchSession(ID string, ipAddress string) error {
+	err := d.db.Model(&Session{}).Where("id = ?", ID).Updates(map[string]any{
+		"last_used_time": time.Now(),
+		"ip_address":     ipAddress,
+	}).Error
+	if err != nil {
+		return fmt.Errorf("failed to update session: %w", err)
+	}
+	return nil
+}
+
+// RevokeUserSession revokes one session of userID. It returns an
+// ErrNotFound if userID has no such active session.
+func (d *Database) RevokeUserSession(userID string, sessionID string) error {
+	result := d.db.Model(&Session{}).
+		Where("id = ? AND user_table_id = ? AND revoked_time IS NULL", sessionID, userID).
+		Update("revoked_time", time.Now())
+	if result.Error != nil {
+		return fmt.Errorf("failed to revoke session: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return notFound("session", nil)
+	}
+	return nil
+}
+
+// RevokeOtherSessions revokes every session of userID except keepSessionID
+// and returns how many it revoked.
+func (d *Database) RevokeOtherSessions(userID string, keepSessionID string) (int64, error) {
+	result := d.db.Model(&Session{}).
+		Where("user_table_id = ? AND id <> ? AND revoked_time IS NULL", userID, keepSessionID).
+		Update("revoked_time", time.Now())
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to revoke sessions: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+// UseRefreshToken marks the refresh token with the given hash as used and
+// returns it. Of several concurrent calls with the same token only one
+// succeeds; the others, like any later one, get ErrRefreshTokenReused. An
+// unknown token gives an ErrNotFound.
+func (d *Database) UseRefreshToken(tokenHash string) (RefreshToken, error) {
+	var refreshToken RefreshToken
+	if err := d.db.Where("id = ?", tokenHash).First(&refreshToken).Error; err != nil {
+		return refreshToken, lookupError("refresh token", err)
+	}
+	if refreshToken.UsedTime.Valid {
+		return refreshToken, ErrRefreshTokenReused
+	}
+	now := time.Now()
+	result := d.db.Model(&RefreshToken{}).Where("id = ? AND used_time IS NULL", tokenHash).Update("used_time", now)
+	if result.Error != nil {
+		return refreshToken, fmt.Errorf("failed to use refresh token: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return refreshToken, ErrRefreshTokenReused
+	}
+	refreshToken.UsedTime = sql.NullTime{Time: now, Valid: true}
+	return refreshToken, nil
+}
+
+func (d *Database) CreateRefreshToken(refreshToken RefreshToken) error {
+	if err := d.db.Create(&refreshToken).Error; err != nil {
+		return fmt.Errorf("failed to create refresh token: %w", err)
+	}
+	return nil
+}
+
+// RevokeAccessToken puts an access token on the revocation list until it
+// would have expired anyway. Entries past that point are pruned on the way.
+// It fails with ErrConflict if the token was already revoked, so that
+// revoking can double as using up a single-use token.
+func (d *Database) RevokeAccessToken(tokenID string, expiresTime time.Time) error {
+	if err := d.db.Where("expires_time < ?", time.Now()).Delete(&RevokedToken{}).Error; err != nil {
+		return fmt.Errorf("failed to prune revoked tokens: %w", err)
+	}
+	result := d.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&RevokedToken{ID: tokenID, ExpiresTime: expiresTime})
+	if result.Error != nil {
+		return fmt.Errorf("failed to revoke token: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return conflict("token has already been revoked", nil)
+	}
+	return nil
+}
+
+func (d *Database) IsAccessTokenRevoked(tokenID string) (bool, error) {
+	var count int64
+	if err := d.db.Model(&RevokedToken{}).Where("id = ?", tokenID).Count(&count).Error; err != nil {
+		return false, fmt.Errorf("failed to check revoked tokens: %w", err)
+	}
+	return count > 0, nil
+}
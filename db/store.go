@@ -0,0 +1,122 @@
+package db
+
+import "time"
+
+// Store is everything the API needs from the persistence layer. Database is
+// the gorm backed implementation; handlers only ever see this interface so
+// they can run against another backend or an in-memory fake.
+type Store interface {
+	UserStore
+	ContactStore
+	ChatStore
+	ChannelStore
+	ChatMemberStore
+	MessageStore
+	ChatInviteStore
+	SessionStore
+	TwoFactorStore
+	PasswordResetStore
+	EmailVerificationStore
+	AuditStore
+}
+
+type UserStore interface {
+	CreateUser(user User) error
+	ReadUser(ID string) (UserTable, error)
+	ReadUserByUsername(username string) (UserTable, error)
+	ReadUsersByEmail(email string) ([]UserTable, error)
+	UpdateUser(ID string, newInfo UserTable) error
+	UpdateEmail(ID string, email string) error
+	DeleteUser(ID string) error
+}
+
+type ContactStore interface {
+	AddContact(userID, contactID string) error
+	GetContact(userID, contactID string) (ContactTable, error)
+	GetUserContacts(userID string) ([]ContactTable, error)
+	DeleteContact(userID, contactID string) error
+}
+
+type ChatStore interface {
+	NewChat(chatName string, chatType ChatType, userTable []UserTable, ownerID string) (string, error)
+	CheckRepeatedDirectChat(userTable []UserTable) (string, error)
+	RenameChat(chatID string, name string) error
+}
+
+type ChannelStore interface {
+	NewChannel(name string, handle string, ownerID string) (string, error)
+	GetChat(chatID string) (ChatTable, error)
+	GetChannelByHandle(handle string) (ChannelListing, error)
+	SearchChannels(query string, limit int) ([]ChannelListing, error)
+}
+
+type ChatMemberStore interface {
+	GetChatMembers(chatID string) ([]ChatMember, error)
+	GetChatMember(chatID string, userID string) (ChatMember, error)
+	GetUsersChatMembers(userID string) ([]ChatMember, error)
+	GetUsersChatIDAndChatName(chatMember []ChatMember) ([]ChatIDAndChatName, error)
+	AddChatMember(chatID string, userID string) error
+	RemoveChatMember(chatID string, userID string) error
+	SetChatMemberRole(chatID string, userID string, role ChatRole) error
+	TransferChatOwnership(chatID string, fromUserID string, toUserID string) error
+}
+
+type ChatInviteStore interface {
+	CreateChatInvite(invite ChatInvite) error
+	GetActiveChatInvites(chatID string) ([]ChatInvite, error)
+	RevokeChatInvite(chatID string, inviteID string) error
+	JoinChat(tokenHash string, userID string) (ChatInvite, error)
+	GetChatJoinRequests(chatID string) ([]ChatJoinRequest, error)
+	ApproveChatJoinRequest(chatID string, userID string) error
+	RejectChatJoinRequest(chatID string, userID string) error
+}
+
+type MessageStore interface {
+	SendMessage(senderID string, chatID string, content string) (Message, error)
+	SendSystemMessage(actorID string, chatID string, content string) (Message, error)
+	GetChatMessages(ChatID string, cursor MessageCursor) (MessagePage, error)
+	GetUserMessage(messageID int, userID string) (Message, error)
+	DeleteMessage(message Message) error
+	GetMessage(messageID int) (Message, error)
+	EditMessage(messageID int, userID string, content string) (Message, error)
+	GetMessageRevisions(messageID int) ([]MessageRevision, error)
+}
+
+type SessionStore interface {
+	CreateSession(session Session, refreshToken RefreshToken) error
+	GetSession(ID string) (Session, error)
+	RevokeSession(ID string) error
+	GetUserSessions(userID string) ([]Session, error)
+	TouchSession(ID string, ipAddress string) error
+	RevokeUserSession(userID string, sessionID string) error
+	RevokeOtherSessions(userID string, keepSessionID string) (int64, error)
+	UseRefreshToken(tokenHash string) (RefreshToken, error)
+	CreateRefreshToken(refreshToken RefreshToken) error
+	RevokeAccessToken(tokenID string, expiresTime time.Time) error
+	IsAccessTokenRevoked(tokenID string) (bool, error)
+}
+
+type TwoFactorStore interface {
+	GetTwoFactor(userID string) (TwoFactor, error)
+	SaveTwoFactorSecret(userID string, secret string) error
+	ConfirmTwoFactor(userID string, step int64, recoveryCodeHashes []string) error
+	UseTOTPStep(userID string, step int64) (bool, error)
+	UseRecoveryCode(userID string, codeHash string) (bool, error)
+	DeleteTwoFactor(userID string) error
+}
+
+type PasswordResetStore interface {
+	CreatePasswordResetToken(token PasswordResetToken) error
+	ResetPassword(tokenHash string, passwordHash string) (string, error)
+}
+
+type EmailVerificationStore interface {
+	CreateEmailVerificationToken(token EmailVerificationToken) error
+	VerifyEmail(tokenHash string) (string, error)
+}
+
+type AuditStore interface {
+	CreateAuditEntry(entry AuditEntry) error
+}
+
+var _ Store = (*Database)(nil)
@@ -0,0 +1,103 @@
+package db
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// GetTwoFactor returns the enrollment of userID, confirmed or not. It returns
+// an ErrNotFound if the user never enrolled.
+func (d *Database) GetTwoFactor(userID string) (TwoFactor, error) {
+	var twoFactor TwoFactor
+	if err := d.db.Where("user_table_id = ?", userID).First(&twoFactor).Error; err != nil {
+		return twoFactor, lookupError("two-factor enrollment", err)
+	}
+	return twoFactor, nil
+}
+
+// SaveTwoFactorSecret starts a new, unconfirmed enrollment, replacing any
+// earlier unconfirmed one.
+func (d *Database) SaveTwoFactorSecret(userID string, secret string) error {
+	err := d.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_table_id = ? AND confirmed_time IS NULL", userID).Delete(&TwoFactor{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&TwoFactor{
+			UserTableID: userID,
+			Secret:      secret,
+			CreatedTime: time.Now(),
+		}).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save two-factor secret: %w", err)
+	}
+	return nil
+}
+
+// ConfirmTwoFactor puts the enrollment of userID in force, recording step as
+// used, and replaces the user's recovery codes.
+func (d *Database) ConfirmTwoFactor(userID string, step int64, recoveryCodeHashes []string) error {
+	err := d.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&TwoFactor{}).
+			Where("user_table_id = ? AND confirmed_time IS NULL", userID).
+			Updates(map[string]any{"confirmed_time": time.Now(), "last_used_step": step})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return notFound("two-factor enrollment", nil)
+		}
+		if err := tx.Where("user_table_id = ?", userID).Delete(&RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		codes := make([]RecoveryCode, 0, len(recoveryCodeHashes))
+		for _, hash := range recoveryCodeHashes {
+			codes = append(codes, RecoveryCode{UserTableID: userID, CodeHash: hash})
+		}
+		return tx.Create(&codes).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to confirm two-factor enrollment: %w", err)
+	}
+	return nil
+}
+
+// UseTOTPStep records that a code for step was accepted. It reports false if
+// a code for this or a later step was accepted before, i.e. the code is being
+// replayed.
+func (d *Database) UseTOTPStep(userID string, step int64) (bool, error) {
+	result := d.db.Model(&TwoFactor{}).
+		Where("user_table_id = ? AND last_used_step < ?", userID, step).
+		Update("last_used_step", step)
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to use TOTP code: %w", result.Error)
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// UseRecoveryCode marks an unused recovery code of userID as used and reports
+// whether there was one.
+func (d *Database) UseRecoveryCode(userID string, codeHash string) (bool, error) {
+	result := d.db.Model(&RecoveryCode{}).
+		Where("user_table_id = ? AND code_hash = ? AND used_time IS NULL", userID, codeHash).
+		Update("used_time", time.Now())
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to use recovery code: %w", result.Error)
+	}
+	return result.RowsAffected == 1, nil
+}
+
+func (d *Database) DeleteTwoFactor(userID string) error {
+	err := d.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_table_id = ?", userID).Delete(&RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_table_id = ?", userID).Delete(&TwoFactor{}).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete two-factor enrollment: %w", err)
+	}
+	return nil
+}
@@ -21,18 +21,29 @@ func (d *Database) ReadUserByUsername(username string) (UserTable, error) {
 	var user UserTable
 	result := d.db.Where("username	 = ?", username).First(&user)
 	if result.Error != nil {
-		return user, fmt.Errorf("failed to read user: %w", result.Error)
+		return user, lookupError("user", result.Error)
 	}
 	return user, nil
 }
 
+// ReadUsersByEmail returns every account registered with email; addresses
+// are not unique.
+func (d *Database) ReadUsersByEmail(email string) ([]UserTable, error) {
+	var users []UserTable
+	result := d.db.Select("id", "username", "email").Where("email = ?", email).Find(&users)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to read users: %w", result.Error)
+	}
+	return users, nil
+}
+
 func (d *Database) ReadUser(ID string) (UserTable, error) {
 	var user UserTable
-	result := d.db.Select("id", "username", "first_name", "last_name", "gender", "email", "date_of_birth", "created_time").
+	result := d.db.Select("id", "username", "first_name", "last_name", "gender", "email", "date_of_birth", "created_time", "email_verified_time").
 		Where("id = ?", ID).
 		First(&user)
 	if result.Error != nil {
-		return user, fmt.Errorf("failed to read user: %w", result.Error)
+		return user, lookupError("user", result.Error)
 	}
 	return user, nil
 }
@@ -46,11 +57,24 @@ func (d *Database) UpdateUser(ID string, newInfo UserTable) error {
 	return nil
 }
 
+// UpdateEmail changes the email address of the user, who has to verify the
+// new one.
+func (d *Database) UpdateEmail(ID string, email string) error {
+	result := d.db.Model(&UserTable{}).Where("id = ?", ID).Updates(map[string]any{
+		"email":               email,
+		"email_verified_time": nil,
+	})
+	if result.Error != nil {
+		return fmt.Errorf("failed to update email: %w", result.Error)
+	}
+	return nil
+}
+
 func (d *Database) DeleteUser(ID string) error {
 	var user UserTable
 	result := d.db.First(&user, "ID=?", ID)
 	if result.Error != nil {
-		return fmt.Errorf("failed to find user to delete: %w", result.Error)
+		return lookupError("user", result.Error)
 	}
 	result = d.db.Delete(&user)
 	if result.Error != nil {
@@ -66,10 +90,10 @@ func (d *Database) AddContact(userID, contactID string) error {
 	}
 	repeatedContact, err := d.isContactExist(userID, contactID)
 	if err != nil {
-		return fmt.Errorf("failed to check if contact exists: %w", err)
+		return err
 	}
 	if repeatedContact {
-		return errors.New("contact already exists")
+		return conflict("contact already exists", nil)
 	}
 	if err := d.db.Create(&contact).Error; err != nil {
 		log.Println("create contact")
@@ -80,7 +104,7 @@ func (d *Database) AddContact(userID, contactID string) error {
 
 func (d *Database) isContactExist(userID, contactID string) (bool, error) {
 	if userID == contactID {
-		return false, errors.New("user id  and contact id are the same")
+		return false, invalid("cannot add yourself as a contact")
 	}
 	contact := ContactTable{
 		UserTableID: userID,
@@ -108,10 +132,11 @@ func (d *Database) GetContact(userID, contactID string) (ContactTable, error) {
 	}
 	if contactExistence {
 		if err := d.db.Model(&ContactTable{}).Where("user_table_id = ? AND contact_id = ?", userID, contactID).First(&contact).Error; err != nil {
-			return ContactTable{}, fmt.Errorf("failed to get contact: %w", err)
+			return ContactTable{}, lookupError("contact", err)
 		}
+		return contact, nil
 	}
-	return ContactTable{}, errors.New("contact not found")
+	return ContactTable{}, notFound("contact", nil)
 }
 
 func (d *Database) GetUserContacts(userID string) ([]ContactTable, error) {
@@ -141,5 +166,5 @@ func (d *Database) DeleteContact(userID, contactID string) error {
 		}
 		return nil
 	}
-	return errors.New("contact for delete not found")
+	return notFound("contact", nil)
 }
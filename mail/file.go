@@ -0,0 +1,55 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"log"
+	netmail "net/mail"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/rs/xid"
+)
+
+// FileMailer writes every message as an .eml file into a directory instead
+// of sending it. It is meant for development and tests.
+type FileMailer struct {
+	dir  string
+	from *netmail.Address
+}
+
+func NewFileMailer(dir string, from *netmail.Address) (*FileMailer, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create mail directory: %w", err)
+	}
+	return &FileMailer{dir: dir, from: from}, nil
+}
+
+func (m *FileMailer) Send(ctx context.Context, message Message) error {
+	data, err := format(m.from, message)
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102T150405"), xid.New())
+	if err := os.WriteFile(filepath.Join(m.dir, name), data, 0o600); err != nil {
+		return fmt.Errorf("failed to write mail: %w", err)
+	}
+	return nil
+}
+
+// LogMailer prints messages to the log. It is the default so that a fresh
+// checkout works without a mail server; never use it in production, reset
+// tokens end up in the log.
+type LogMailer struct {
+	from *netmail.Address
+}
+
+func NewLogMailer(from *netmail.Address) *LogMailer {
+	return &LogMailer{from: from}
+}
+
+func (m *LogMailer) Send(ctx context.Context, message Message) error {
+	log.Printf("mail from %s to %s: %s\n%s", m.from, message.To, message.Subject, message.Body)
+	return nil
+}
@@ -1,26 +1,128 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
 
 	"github.com/mhghw/fara-message/api"
+	"github.com/mhghw/fara-message/config"
 	"github.com/mhghw/fara-message/db"
-	"github.com/rs/xid"
 )
 
-// implement this with os args
-var port = flag.Int("port", 8080, "Port to run the HTTP server")
+const usage = `usage: fara-message [flags]                 run the server
+       fara-message [flags] migrate up       apply pending migrations
+       fara-message [flags] migrate down [n] roll back the last n migrations (default 1)
+       fara-message [flags] migrate status   list migrations and whether they are applied`
 
 func main() {
-	db.NewDatabase()
-	guid := xid.New()
-	fmt.Println(guid.String())
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flags := config.RegisterFlags(flag.CommandLine)
 	flag.Parse()
-	err := api.RunWebServer(*port)
+	cfg, err := flags.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	database, err := db.NewDatabase(db.Config{
+		Driver:          cfg.Database.Driver,
+		DSN:             cfg.Database.DSN,
+		MaxOpenConns:    cfg.Database.MaxOpenConns,
+		MaxIdleConns:    cfg.Database.MaxIdleConns,
+		ConnMaxLifetime: cfg.Database.ConnMaxLifetime.Std(),
+	})
+	if err != nil {
+		log.Fatalf("failed to open database: %v", err)
+	}
+
+	if flag.Arg(0) == "migrate" {
+		if err := runMigrate(database, flag.Args()[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if flag.NArg() > 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if cfg.Database.MigrateOnStart {
+		if _, err := database.MigrateUp(); err != nil {
+			log.Fatalf("failed to migrate: %v", err)
+		}
+	} else if err := database.CheckSchema(); err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	server, err := api.NewServer(cfg, database)
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = server.Run(ctx)
 	if err != nil {
 		log.Print("failed to start HTTP server:", err)
 	}
 
 }
+
+func runMigrate(database *db.Database, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing migrate command\n%s", usage)
+	}
+	switch args[0] {
+	case "up":
+		ran, err := database.MigrateUp()
+		if err != nil {
+			return err
+		}
+		if len(ran) == 0 {
+			fmt.Println("schema is up to date")
+		}
+		return nil
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return fmt.Errorf("invalid number of steps %q", args[1])
+			}
+			steps = n
+		}
+		ran, err := database.MigrateDown(steps)
+		if err != nil {
+			return err
+		}
+		if len(ran) == 0 {
+			fmt.Println("nothing to roll back")
+		}
+		return nil
+	case "status":
+		statuses, err := database.MigrationStatus()
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			state := "pending"
+			if status.Applied {
+				state = "applied " + status.AppliedTime.Format("2006-01-02 15:04:05")
+			}
+			if status.Modified {
+				state += " (MODIFIED since applied)"
+			}
+			fmt.Printf("%04d  %-40s %s\n", status.Version, status.Name, state)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown migrate command %q\n%s", args[0], usage)
+	}
+}
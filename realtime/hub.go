@@ -0,0 +1,278 @@
+package realtime
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	EventMessageCreated = "message.created"
+	EventMessageEdited  = "message.edited"
+	EventMessageDeleted = "message.deleted"
+	EventChatCreated    = "chat.created"
+	EventChatUpdated    = "chat.updated"
+)
+
+// Event is what gets pushed to online users. Data is marshalled to JSON by
+// the transport. ID is assigned by the hub and increases with every publish,
+// so a client can resume after the last ID it saw.
+type Event struct {
+	ID     uint64 `json:"id"`
+	Type   string `json:"type"`
+	ChatID string `json:"chat_id"`
+	Data   any    `json:"data"`
+}
+
+// published is an event in the replay history together with its recipients.
+type published struct {
+	event   Event
+	userIDs []string
+}
+
+// Subscription is one connection of one user, opened under one of their
+// login sessions. Events arrive on C; when the hub drops the subscription, C
+// is closed and Dropped or Ended report why.
+type Subscription struct {
+	UserID    string
+	SessionID string
+	C         <-chan Event
+
+	send    chan Event
+	mu      sync.Mutex
+	closed  bool
+	dropped bool
+	ended   bool
+}
+
+// Dropped reports whether the hub closed the subscription because the
+// consumer fell too far behind.
+func (s *Subscription) Dropped() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dropped
+}
+
+// Ended reports whether the hub closed the subscription because its session
+// was logged out or revoked.
+func (s *Subscription) Ended() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ended
+}
+
+func (s *Subscription) close(dropped bool, ended bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	s.closed = true
+	s.dropped = dropped
+	s.ended = ended
+	close(s.send)
+}
+
+// Hub fans events out to the subscriptions of the users they are addressed
+// to and keeps the latest events around for clients that reconnect. It only
+// knows about connections in this process.
+type Hub struct {
+	bufferSize int
+
+	mu      sync.Mutex
+	users   map[string]map[*Subscription]struct{}
+	lastID  uint64
+	history []published
+	next    int
+	closed  bool
+}
+
+// NewHub creates a hub whose subscriptions buffer up to bufferSize events and
+// which remembers the last historySize events for resuming. A subscriber that
+// lets its buffer fill up is dropped rather than allowed to hold back
+// everyone else.
+func NewHub(bufferSize, historySize int) *Hub {
+	return &Hub{
+		bufferSize: bufferSize,
+		users:      map[string]map[*Subscription]struct{}{},
+		// Starting from the clock keeps IDs increasing across restarts, so
+		// an ID handed out by a previous process is recognised as too old
+		// to resume from instead of being mistaken for a recent one.
+		lastID:  uint64(time.Now().UnixMicro()),
+		history: make([]published, 0, historySize),
+	}
+}
+
+func (h *Hub) Subscribe(userID string, sessionID string) *Subscription {
+	sub, _, _ := h.SubscribeFrom(userID, sessionID, 0)
+	return sub
+}
+
+// SubscribeFrom subscribes userID under sessionID and returns the buffered events addressed
+// to them with an ID above lastEventID, oldest first. Nothing published
+// concurrently is lost or delivered twice. complete is false when events
+// after lastEventID have already fallen out of the history, in which case the
+// client has to reload its state. A lastEventID of 0 replays nothing.
+func (h *Hub) SubscribeFrom(userID string, sessionID string, lastEventID uint64) (sub *Subscription, replay []Event, complete bool) {
+	send := make(chan Event, h.bufferSize)
+	sub = &Subscription{UserID: userID, SessionID: sessionID, C: send, send: send}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		sub.close(false, false)
+		return sub, nil, false
+	}
+	if h.users[userID] == nil {
+		h.users[userID] = map[*Subscription]struct{}{}
+	}
+	h.users[userID][sub] = struct{}{}
+
+	if lastEventID == 0 {
+		return sub, nil, true
+	}
+	oldest := h.lastID + 1
+	for _, p := range h.ordered() {
+		if p.event.ID < oldest {
+			oldest = p.event.ID
+		}
+		if p.event.ID <= lastEventID {
+			continue
+		}
+		for _, id := range p.userIDs {
+			if id == userID {
+				replay = append(replay, p.event)
+				break
+			}
+		}
+	}
+	complete = lastEventID >= oldest-1 && lastEventID <= h.lastID
+	return sub, replay, complete
+}
+
+// ordered returns the history oldest first. It must be called with h.mu held.
+func (h *Hub) ordered() []published {
+	if len(h.history) < cap(h.history) {
+		return h.history
+	}
+	return append(h.history[h.next:len(h.history):len(h.history)], h.history[:h.next]...)
+}
+
+// record must be called with h.mu held.
+func (h *Hub) record(event Event, userIDs []string) {
+	if cap(h.history) == 0 {
+		return
+	}
+	p := published{event: event, userIDs: userIDs}
+	if len(h.history) < cap(h.history) {
+		h.history = append(h.history, p)
+		return
+	}
+	h.history[h.next] = p
+	h.next = (h.next + 1) % cap(h.history)
+}
+
+func (h *Hub) Unsubscribe(sub *Subscription) {
+	h.mu.Lock()
+	h.remove(sub)
+	h.mu.Unlock()
+	sub.close(false, false)
+}
+
+// remove must be called with h.mu held.
+func (h *Hub) remove(sub *Subscription) {
+	subs := h.users[sub.UserID]
+	delete(subs, sub)
+	if len(subs) == 0 {
+		delete(h.users, sub.UserID)
+	}
+}
+
+// Publish assigns event the next ID, records it and delivers it to every
+// subscription of every user in userIDs. It never blocks: subscriptions with
+// a full buffer are dropped.
+func (h *Hub) Publish(userIDs []string, event Event) {
+	var slow []*Subscription
+
+	h.mu.Lock()
+	h.lastID++
+	event.ID = h.lastID
+	h.record(event, userIDs)
+	for _, userID := range userIDs {
+		for sub := range h.users[userID] {
+			select {
+			case sub.send <- event:
+			default:
+				slow = append(slow, sub)
+			}
+		}
+	}
+	for _, sub := range slow {
+		h.remove(sub)
+	}
+	h.mu.Unlock()
+
+	for _, sub := range slow {
+		sub.close(true, false)
+	}
+}
+
+// EndSession closes the subscriptions opened under sessionID, once it has
+// been logged out or revoked.
+func (h *Hub) EndSession(sessionID string) {
+	h.mu.Lock()
+	var ended []*Subscription
+	for _, subs := range h.users {
+		for sub := range subs {
+			if sub.SessionID == sessionID {
+				ended = append(ended, sub)
+			}
+		}
+	}
+	h.endLocked(ended)
+}
+
+// EndUserSessions closes the subscriptions of userID opened under any
+// session but keepSessionID. An empty keepSessionID closes all of them.
+func (h *Hub) EndUserSessions(userID string, keepSessionID string) {
+	h.mu.Lock()
+	var ended []*Subscription
+	for sub := range h.users[userID] {
+		if sub.SessionID != keepSessionID {
+			ended = append(ended, sub)
+		}
+	}
+	h.endLocked(ended)
+}
+
+// endLocked removes subs and closes them. It must be called with h.mu held
+// and releases it.
+func (h *Hub) endLocked(subs []*Subscription) {
+	for _, sub := range subs {
+		h.remove(sub)
+	}
+	h.mu.Unlock()
+	for _, sub := range subs {
+		sub.close(false, true)
+	}
+}
+
+// Online reports whether userID has at least one open subscription.
+func (h *Hub) Online(userID string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.users[userID]) > 0
+}
+
+// Close ends every subscription; later subscriptions are closed immediately.
+func (h *Hub) Close() {
+	h.mu.Lock()
+	h.closed = true
+	users := h.users
+	h.users = map[string]map[*Subscription]struct{}{}
+	h.mu.Unlock()
+	for _, subs := range users {
+		for sub := range subs {
+			sub.close(false, false)
+		}
+	}
+}
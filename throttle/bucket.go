@@ -0,0 +1,97 @@
+package throttle
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// BucketPolicy is a token bucket: it holds up to Burst tokens and refills at
+// Rate tokens per second. Every request takes one.
+type BucketPolicy struct {
+	Rate  float64
+	Burst int
+}
+
+// Window is how long an empty bucket takes to fill up again.
+func (p BucketPolicy) Window() time.Duration {
+	return time.Duration(float64(p.Burst) / p.Rate * float64(time.Second))
+}
+
+// Take is the outcome of taking a token. Reset is how long until the bucket
+// is full again; RetryAfter is zero when the request was allowed and
+// otherwise how long until the next token.
+type Take struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+// BucketStore keeps token buckets. Like Store, MemoryBuckets only limits a
+// single instance; several need a shared implementation.
+type BucketStore interface {
+	Take(ctx context.Context, key string, now time.Time, policy BucketPolicy) (Take, error)
+}
+
+// bucket remembers the policy it was last taken under, so that sweeping
+// refills it at its own rate and not that of whoever happens to sweep.
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	policy  BucketPolicy
+}
+
+type MemoryBuckets struct {
+	mu      sync.Mutex
+	buckets map[string]bucket
+	taken   int
+}
+
+func NewMemoryBuckets() *MemoryBuckets {
+	return &MemoryBuckets{buckets: map[string]bucket{}}
+}
+
+func (s *MemoryBuckets) Take(ctx context.Context, key string, now time.Time, policy BucketPolicy) (Take, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.taken++
+	if s.taken%sweepEvery == 0 {
+		// A bucket that has filled up again is the same as no bucket.
+		for k, b := range s.buckets {
+			if b.refill(now, b.policy) >= float64(b.policy.Burst) {
+				delete(s.buckets, k)
+			}
+		}
+	}
+
+	b, ok := s.buckets[key]
+	if ok {
+		b.tokens = b.refill(now, policy)
+	} else {
+		b.tokens = float64(policy.Burst)
+	}
+	b.updated = now
+	b.policy = policy
+	take := Take{Limit: policy.Burst}
+	if b.tokens >= 1 {
+		b.tokens--
+		take.Allowed = true
+	} else {
+		take.RetryAfter = seconds((1 - b.tokens) / policy.Rate)
+	}
+	s.buckets[key] = b
+	take.Remaining = int(math.Floor(b.tokens))
+	take.Reset = seconds((float64(policy.Burst) - b.tokens) / policy.Rate)
+	return take, nil
+}
+
+func (b bucket) refill(now time.Time, policy BucketPolicy) float64 {
+	return math.Min(float64(policy.Burst), b.tokens+now.Sub(b.updated).Seconds()*policy.Rate)
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
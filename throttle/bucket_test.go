@@ -0,0 +1,28 @@
+package throttle
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryBucketsSweepKeepsEachPolicy(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	slow := BucketPolicy{Rate: 1.0 / 3600, Burst: 1}
+	fast := BucketPolicy{Rate: 1000, Burst: 1}
+	buckets := NewMemoryBuckets()
+
+	if take, _ := buckets.Take(ctx, "slow", now, slow); !take.Allowed {
+		t.Fatal("first take of the slow bucket was not allowed")
+	}
+	// Enough takes under the fast policy to trigger a sweep. A second later
+	// a fast bucket would be full again, the slow one is not.
+	later := now.Add(time.Second)
+	for i := 0; i < sweepEvery; i++ {
+		buckets.Take(ctx, "fast", later, fast)
+	}
+	if take, _ := buckets.Take(ctx, "slow", later, slow); take.Allowed {
+		t.Error("the sweep refilled the slow bucket at the fast rate")
+	}
+}
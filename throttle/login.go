@@ -0,0 +1,147 @@
+package throttle
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// LoginPolicy decides how long a key has to wait after its failures. The
+// first DelayAfter failures are free; each further one doubles the wait,
+// starting at BaseDelay and capped at MaxDelay. At LockoutThreshold
+// failures the key is locked for LockoutDuration.
+type LoginPolicy struct {
+	Window           time.Duration
+	DelayAfter       int
+	BaseDelay        time.Duration
+	MaxDelay         time.Duration
+	LockoutThreshold int
+	LockoutDuration  time.Duration
+}
+
+// wait returns how long after the last failure the next attempt is allowed,
+// and whether that is a lockout rather than a delay.
+func (p LoginPolicy) wait(failures int) (time.Duration, bool) {
+	if p.LockoutThreshold > 0 && failures >= p.LockoutThreshold {
+		return p.LockoutDuration, true
+	}
+	if failures < p.DelayAfter || p.BaseDelay <= 0 {
+		return 0, false
+	}
+	delay := p.BaseDelay
+	for i := p.DelayAfter; i < failures && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	return delay, false
+}
+
+// LoginLimiter throttles login attempts per key and per client IP. The key
+// limit stops guessing one password from many addresses, the IP limit stops
+// trying one password against many accounts.
+type LoginLimiter struct {
+	store   Store
+	account LoginPolicy
+	ip      LoginPolicy
+}
+
+func NewLoginLimiter(store Store, account LoginPolicy, ip LoginPolicy) *LoginLimiter {
+	return &LoginLimiter{store: store, account: account, ip: ip}
+}
+
+// Verdict is the outcome of Check and Fail. RetryAfter is zero when the
+// client may try again right away.
+type Verdict struct {
+	RetryAfter time.Duration
+	// Locked is set when the wait is a lockout rather than a delay.
+	Locked bool
+}
+
+// AccountKey is the key of password attempts for a username. It folds case
+// so that "Alice" and "alice" share one budget.
+func AccountKey(username string) string {
+	return "account:" + strings.ToLower(username)
+}
+
+// MFAKey is the key of two-factor codes entered for a user.
+func MFAKey(userID string) string {
+	return "mfa:" + userID
+}
+
+// PasswordKey is the key of a signed-in user confirming a change with their
+// current password.
+func PasswordKey(userID string) string {
+	return "password:" + userID
+}
+
+// Check counts an attempt for key from ip and reports whether it has to
+// wait. The attempt counts as failed until Succeed is called, so concurrent
+// attempts cannot all pass before the first of them fails. Attempts that
+// have to wait count too.
+func (l *LoginLimiter) Check(ctx context.Context, key string, ip string) (Verdict, error) {
+	now := time.Now()
+	var verdict Verdict
+	for _, k := range l.keys(key, ip) {
+		before, err := l.store.AddFailure(ctx, k.key, now, k.policy.Window)
+		if err != nil {
+			return Verdict{}, err
+		}
+		verdict = verdict.worse(k.policy, before, now)
+	}
+	return verdict, nil
+}
+
+// Fail returns how long the client has to wait after an attempt that Check
+// counted has failed.
+func (l *LoginLimiter) Fail(ctx context.Context, key string, ip string) (Verdict, error) {
+	now := time.Now()
+	var verdict Verdict
+	for _, k := range l.keys(key, ip) {
+		attempts, err := l.store.Get(ctx, k.key, now, k.policy.Window)
+		if err != nil {
+			return Verdict{}, err
+		}
+		verdict = verdict.worse(k.policy, attempts, now)
+	}
+	return verdict, nil
+}
+
+// Succeed forgets the failures of key. The IP only gets back the attempt
+// Check counted; its other failures stay, otherwise an attacker could reset
+// them by logging into an account of their own.
+func (l *LoginLimiter) Succeed(ctx context.Context, key string, ip string) error {
+	if err := l.store.Reset(ctx, key); err != nil {
+		return err
+	}
+	return l.store.Forgive(ctx, ipKey(ip))
+}
+
+type limitKey struct {
+	key    string
+	policy LoginPolicy
+}
+
+func (l *LoginLimiter) keys(key string, ip string) []limitKey {
+	return []limitKey{
+		{key: key, policy: l.account},
+		{key: ipKey(ip), policy: l.ip},
+	}
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+func (v Verdict) worse(policy LoginPolicy, attempts Attempts, now time.Time) Verdict {
+	wait, locked := policy.wait(attempts.Failures)
+	retryAfter := attempts.LastFailure.Add(wait).Sub(now)
+	if retryAfter > v.RetryAfter {
+		return Verdict{RetryAfter: retryAfter, Locked: locked || v.Locked}
+	}
+	if retryAfter > 0 && locked {
+		v.Locked = true
+	}
+	return v
+}
@@ -0,0 +1,62 @@
+package throttle
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLoginLimiterCountsConcurrentAttempts(t *testing.T) {
+	ctx := context.Background()
+	policy := LoginPolicy{Window: time.Hour, DelayAfter: 3, BaseDelay: time.Minute, MaxDelay: time.Hour, LockoutThreshold: 100, LockoutDuration: time.Hour}
+	limiter := NewLoginLimiter(NewMemoryStore(), policy, LoginPolicy{Window: time.Hour, LockoutThreshold: 1000, LockoutDuration: time.Hour})
+
+	var passed atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			verdict, err := limiter.Check(ctx, AccountKey("alice"), "192.0.2.1")
+			if err != nil {
+				t.Error(err)
+			}
+			if verdict.RetryAfter <= 0 {
+				passed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := passed.Load(); n != 3 {
+		t.Errorf("%d concurrent attempts got through, want 3", n)
+	}
+}
+
+func TestLoginLimiterSucceed(t *testing.T) {
+	ctx := context.Background()
+	policy := LoginPolicy{Window: time.Hour, LockoutThreshold: 2, LockoutDuration: time.Hour}
+	store := NewMemoryStore()
+	limiter := NewLoginLimiter(store, policy, policy)
+
+	// A failed guess at the account and a login into another one.
+	limiter.Check(ctx, AccountKey("alice"), "192.0.2.1")
+	limiter.Check(ctx, AccountKey("bobby"), "192.0.2.1")
+	if err := limiter.Succeed(ctx, AccountKey("bobby"), "192.0.2.1"); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	if a, _ := store.Get(ctx, AccountKey("bobby"), now, time.Hour); a.Failures != 0 {
+		t.Errorf("bobby has %d failures after logging in, want 0", a.Failures)
+	}
+	if a, _ := store.Get(ctx, ipKey("192.0.2.1"), now, time.Hour); a.Failures != 1 {
+		t.Errorf("the IP has %d failures, want the 1 for alice", a.Failures)
+	}
+	// Codes for a user do not share a budget with a username that looks
+	// like them.
+	if MFAKey("alice") == AccountKey("mfa:alice") {
+		t.Error("MFA and account keys collide")
+	}
+}
@@ -0,0 +1,96 @@
+// Package throttle slows down and locks out clients that fail too often,
+// such as password guessers, and rate limits clients that simply send too
+// many requests.
+package throttle
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Attempts is the failure history of one key, e.g. one account or one IP.
+// An attempt counts as a failure from the moment it is made until it
+// succeeds, so that parallel attempts cannot all get in before any of them
+// has failed.
+type Attempts struct {
+	Failures    int
+	LastFailure time.Time
+}
+
+// Store keeps failure counts. MemoryStore is enough for a single instance;
+// several instances behind a load balancer need a shared implementation, or
+// each of them grants an attacker its own budget.
+type Store interface {
+	// AddFailure records a failure of key at now and returns the attempts
+	// as they were before it. It has to be atomic: two concurrent calls
+	// must not see the same attempts. Failures are forgotten once the key
+	// has had none for window.
+	AddFailure(ctx context.Context, key string, now time.Time, window time.Duration) (Attempts, error)
+	// Get returns the attempts of key as of now, zero if there are none.
+	Get(ctx context.Context, key string, now time.Time, window time.Duration) (Attempts, error)
+	// Forgive takes back one failure of key, for an attempt that succeeded
+	// after all.
+	Forgive(ctx context.Context, key string) error
+	Reset(ctx context.Context, key string) error
+}
+
+// sweepEvery is how many failures MemoryStore records between sweeps of
+// expired keys.
+const sweepEvery = 1024
+
+type MemoryStore struct {
+	mu       sync.Mutex
+	attempts map[string]Attempts
+	added    int
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{attempts: map[string]Attempts{}}
+}
+
+func (s *MemoryStore) AddFailure(ctx context.Context, key string, now time.Time, window time.Duration) (Attempts, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.added++
+	if s.added%sweepEvery == 0 {
+		for k, a := range s.attempts {
+			if now.Sub(a.LastFailure) >= window {
+				delete(s.attempts, k)
+			}
+		}
+	}
+	before := s.attempts[key]
+	if now.Sub(before.LastFailure) >= window {
+		before = Attempts{}
+	}
+	s.attempts[key] = Attempts{Failures: before.Failures + 1, LastFailure: now}
+	return before, nil
+}
+
+func (s *MemoryStore) Get(ctx context.Context, key string, now time.Time, window time.Duration) (Attempts, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a := s.attempts[key]
+	if now.Sub(a.LastFailure) >= window {
+		return Attempts{}, nil
+	}
+	return a, nil
+}
+
+func (s *MemoryStore) Forgive(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if a, ok := s.attempts[key]; ok && a.Failures > 0 {
+		a.Failures--
+		s.attempts[key] = a
+	}
+	return nil
+}
+
+func (s *MemoryStore) Reset(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.attempts, key)
+	return nil
+}